@@ -1,12 +1,23 @@
+//go:build cdt_cpp && cgo
+
 #include <stdint.h>
 #include <stdlib.h>
 #include <float.h>
+#include <math.h>
 #include <stdio.h>
 
 typedef float f32;
+typedef double f64;
 typedef int32_t s32;
 typedef int8_t s8;
 
+// error codes returned by triangulate; these must match the Go side.
+enum {
+	errOutOfBounds = -1,
+	errDegenerateGraph = -2,
+	errNonTermination = -3,
+};
+
 template <typename T> struct Vec {
 	T *data = 0;
 	s32 size = 0;
@@ -53,14 +64,12 @@ struct Triangulation {
 	s32 *Triangles;
 	s8 *fixed;
 	s32 *newTris;
-	s32 *newEdges;
-	s32 *checkTris;
 	s32 VertI, EdgeI, TriangleI;
-	s32 newTriI, newEdgeI, checkTriI;
+	s32 newTriI;
 
 	s32 AddPoint(f32 x, f32 y);
-	void AddEdge(s32 indexA, s32 indexB);
-	void retriangulate(Vec<s32> &ringEdges, Vec<s32> &vertIs, s32 edgeIs[2]);
+	s32 AddEdge(s32 indexA, s32 indexB);
+	void retriangulate(Vec<s32> &vertIs, s32 lo, s32 hi, s32 edgeIs[2]);
 	void getSharedQuad(s32 quad[4], s32 triA, s32 triB);
 };
 
@@ -75,9 +84,7 @@ extern "C" s32 triangulate(f32 left, f32 right, f32 bottom, f32 top,
 	s32 rEdges = 3 * rPoints - 7;
 	t.newTris = (s32 *)malloc(4 * 3 * rTris);
 	t.Edges = (s32 *)malloc(4 * 2 * rEdges);
-	t.newEdges = (s32 *)malloc(4 * 2 * rEdges);
 	t.fixed = (s8 *)malloc(rEdges);
-	t.checkTris = (s32 *)malloc(4 * rTris);
 
 	t.Verts[0] = left;
 	t.Verts[1] = bottom;
@@ -112,162 +119,277 @@ extern "C" s32 triangulate(f32 left, f32 right, f32 bottom, f32 top,
 	t.fixed[3] = true;
 	t.fixed[4] = true;
 
+	s32 result = 0;
 	for (s32 i = 0; i < nPoints; i++) {
 		s32 ptI = t.AddPoint(points[2 * i], points[2 * i + 1]);
 		if (ptI < 0) {
-			return ptI;
+			result = ptI;
+			goto done;
 		}
 		srcToDstIs[i] = ptI;
 	}
 
 	for (s32 i = 0; i < nEdges; i++) {
-		t.AddEdge(srcToDstIs[edges[2 * i]], srcToDstIs[edges[2 * i + 1]]);
+		result =
+		    t.AddEdge(srcToDstIs[edges[2 * i]], srcToDstIs[edges[2 * i + 1]]);
+		if (result < 0) {
+			goto done;
+		}
 	}
+	result = t.VertI;
 
+done:
 	free(t.newTris);
 	free(t.Edges);
-	free(t.newEdges);
 	free(t.fixed);
-	free(t.checkTris);
 
-	return t.VertI;
+	return result;
 }
 
-struct indexedVert {
-	s32 i;
-	f32 f;
-};
+// The predicates below follow Shewchuk, "Adaptive Precision Floating-Point
+// Arithmetic and Fast Robust Geometric Predicates", as in predicates.go.  Each
+// is evaluated in f64 first, and again exactly, as an expansion, when the
+// result is too close to 0 for its error bound to settle the sign.  This
+// relies on f64 arithmetic being done in f64, as with SSE2, rather than at a
+// higher precision.
+
+static const f64 epsilon = 1.0 / 9007199254740992.0; // 2^-53
+static const f64 orientErrBound = (3 + 16 * epsilon) * epsilon;
+static const f64 inCircleErrBound = (10 + 96 * epsilon) * epsilon;
+
+// twoSum sets sum to a + b and err to the error in it.
+static void twoSum(f64 a, f64 b, f64 &sum, f64 &err) {
+	sum = a + b;
+	f64 bv = sum - a;
+	f64 av = sum - bv;
+	err = (a - av) + (b - bv);
+}
+
+// twoProduct stores a*b exactly as an expansion in h, returning its length.
+static s32 twoProduct(f64 a, f64 b, f64 *h) {
+	f64 p = a * b;
+	h[0] = fma(a, b, -p);
+	h[1] = p;
+	return 2;
+}
+
+// growExpansion stores the expansion e + b in h, which may be e, dropping
+// zeros and returning its length.
+static s32 growExpansion(s32 elen, const f64 *e, f64 b, f64 *h) {
+	s32 hlen = 0;
+	f64 q = b;
+	for (s32 i = 0; i < elen; i++) {
+		f64 err;
+		twoSum(q, e[i], q, err);
+		if (err != 0) {
+			h[hlen++] = err;
+		}
+	}
+	if (q != 0 || hlen == 0) {
+		h[hlen++] = q;
+	}
+	return hlen;
+}
+
+// sumExpansions adds the expansion f to the expansion e in place, returning
+// its length; e must have room for elen + flen values.
+static s32 sumExpansions(s32 elen, f64 *e, s32 flen, const f64 *f) {
+	for (s32 i = 0; i < flen; i++) {
+		elen = growExpansion(elen, e, f[i], e);
+	}
+	return elen;
+}
+
+// scaleExpansion stores the expansion e*b in h, which must have room for
+// 2*elen values, dropping zeros and returning its length.
+static s32 scaleExpansion(s32 elen, const f64 *e, f64 b, f64 *h) {
+	s32 hlen = 0;
+	f64 p[2], q = 0, sum, err;
+	for (s32 i = 0; i < elen; i++) {
+		twoProduct(e[i], b, p);
+		if (i == 0) {
+			q = p[1];
+			if (p[0] != 0) {
+				h[hlen++] = p[0];
+			}
+			continue;
+		}
+		twoSum(q, p[0], sum, err);
+		if (err != 0) {
+			h[hlen++] = err;
+		}
+		twoSum(p[1], sum, q, err);
+		if (err != 0) {
+			h[hlen++] = err;
+		}
+	}
+	if (q != 0 || hlen == 0) {
+		h[hlen++] = q;
+	}
+	return hlen;
+}
 
-int indexedVertCompare(const void *a, const void *b) {
-	auto iva = (const indexedVert *)a;
-	auto ivb = (const indexedVert *)b;
-	return iva->f < ivb->f ? -1 : iva->f > ivb->f;
+// estimate returns the f64 nearest to the expansion e, or near enough to have
+// the same sign.
+static f64 estimate(s32 elen, const f64 *e) {
+	f64 sum = 0;
+	for (s32 i = 0; i < elen; i++) {
+		sum += e[i];
+	}
+	return sum;
 }
 
-// px, py, ax, ay, bx, by, cx, cy
-void getBarycentric(f32 bary[2], f32 ps[8]) {
-	f32 v0x = ps[6] - ps[2];
-	f32 v0y = ps[7] - ps[3];
-	f32 v1x = ps[4] - ps[2];
-	f32 v1y = ps[5] - ps[3];
-	f32 v2x = ps[0] - ps[2];
-	f32 v2y = ps[1] - ps[3];
-	f32 dot00 = v0x * v0x + v0y * v0y;
-	f32 dot01 = v0x * v1x + v0y * v1y;
-	f32 dot02 = v0x * v2x + v0y * v2y;
-	f32 dot11 = v1x * v1x + v1y * v1y;
-	f32 dot12 = v1x * v2x + v1y * v2y;
-	f32 norm = dot00 * dot11 - dot01 * dot01;
-	bary[0] = (dot11 * dot02 - dot01 * dot12) / norm;
-	bary[1] = (dot00 * dot12 - dot01 * dot02) / norm;
+// orientExact stores the determinant computed by orient as an expansion in
+// det, which must have room for 12 values, returning its length.
+static s32 orientExact(const f32 *a, const f32 *b, const f32 *c, f64 *det) {
+	f64 p[2];
+	s32 len = twoProduct(a[0], b[1], det);
+	len = sumExpansions(len, det, twoProduct(-a[0], c[1], p), p);
+	len = sumExpansions(len, det, twoProduct(-a[1], b[0], p), p);
+	len = sumExpansions(len, det, twoProduct(a[1], c[0], p), p);
+	len = sumExpansions(len, det, twoProduct(b[0], c[1], p), p);
+	return sumExpansions(len, det, twoProduct(-b[1], c[0], p), p);
 }
 
-s8 pointInTriangle(f32 ps[8]) {
-	f32 bary[2];
-	getBarycentric(bary, ps);
-	return bary[0] >= -4e-6f && bary[1] >= -4e-6f &&
-	       bary[0] + bary[1] < 1.0000076f;
+// orient returns a positive number if c is to the left of the line from a to
+// b, a negative number if it is to the right, and 0 if a, b and c are
+// collinear.  The sign is always exact.
+f64 orient(const f32 *a, const f32 *b, const f32 *c) {
+	f64 left = ((f64)b[0] - a[0]) * ((f64)c[1] - a[1]);
+	f64 right = ((f64)b[1] - a[1]) * ((f64)c[0] - a[0]);
+	f64 det = left - right;
+	if (fabs(det) >= orientErrBound * (fabs(left) + fabs(right))) {
+		return det;
+	}
+	f64 exact[12];
+	return estimate(orientExact(a, b, c, exact), exact);
 }
 
-s8 pointInAngle(f32 ps[8]) {
-	f32 bary[2];
-	getBarycentric(bary, ps);
-	return bary[0] >= -4e-6f && bary[1] >= -4e-6f;
+// inCircleExact returns the determinant computed by inCircle, evaluated
+// exactly as the determinant of the rows x, y, x^2 + y^2, 1 for a, b, c and d,
+// expanded along the third column.
+static f64 inCircleExact(const f32 *a, const f32 *b, const f32 *c,
+                         const f32 *d) {
+	const f32 *pts[4] = {a, b, c, d};
+	f64 det[4 * 96], term[96], minor[12], lift[4], scaled[24];
+	s32 detLen = 0;
+	for (s32 i = 0; i < 4; i++) {
+		// the other three points, in order:
+		const f32 *others[3];
+		for (s32 j = 0, k = 0; j < 4; j++) {
+			if (j != i) {
+				others[k++] = pts[j];
+			}
+		}
+		s32 minorLen = orientExact(others[0], others[1], others[2], minor);
+		f64 y2[2];
+		s32 liftLen = twoProduct(pts[i][0], pts[i][0], lift);
+		liftLen = sumExpansions(
+		    liftLen, lift, twoProduct(pts[i][1], pts[i][1], y2), y2);
+		s32 termLen = 0;
+		for (s32 j = 0; j < liftLen; j++) {
+			s32 scaledLen = scaleExpansion(minorLen, minor, lift[j], scaled);
+			termLen = sumExpansions(termLen, term, scaledLen, scaled);
+		}
+		if (i % 2 == 1) {
+			for (s32 j = 0; j < termLen; j++) {
+				term[j] = -term[j];
+			}
+		}
+		detLen = sumExpansions(detLen, det, termLen, term);
+	}
+	return estimate(detLen, det);
 }
 
-f32 mat4Det(f32 m[16]) {
-	return m[0] * m[5] * m[10] * m[15] - m[0] * m[5] * m[11] * m[14] -
-	       m[0] * m[6] * m[9] * m[15] + m[0] * m[6] * m[11] * m[13] +
-	       m[0] * m[7] * m[9] * m[14] - m[0] * m[7] * m[10] * m[13] -
-	       m[1] * m[4] * m[10] * m[15] + m[1] * m[4] * m[11] * m[14] +
-	       m[1] * m[6] * m[8] * m[15] - m[1] * m[6] * m[11] * m[12] -
-	       m[1] * m[7] * m[8] * m[14] + m[1] * m[7] * m[10] * m[12] +
-	       m[2] * m[4] * m[9] * m[15] - m[2] * m[4] * m[11] * m[13] -
-	       m[2] * m[5] * m[8] * m[15] + m[2] * m[5] * m[11] * m[12] +
-	       m[2] * m[7] * m[8] * m[13] - m[2] * m[7] * m[9] * m[12] -
-	       m[3] * m[4] * m[9] * m[14] + m[3] * m[4] * m[10] * m[13] +
-	       m[3] * m[5] * m[8] * m[14] - m[3] * m[5] * m[10] * m[12] -
-	       m[3] * m[6] * m[8] * m[13] + m[3] * m[6] * m[9] * m[12];
+// inCircle returns true if d is inside the circumcircle of the clockwise
+// triangle abc.  Points exactly on the circle are outside, so that flipping an
+// edge can't be undone by the opposite test.
+s8 inCircle(const f32 *a, const f32 *b, const f32 *c, const f32 *d) {
+	f64 adx = (f64)a[0] - d[0], ady = (f64)a[1] - d[1];
+	f64 bdx = (f64)b[0] - d[0], bdy = (f64)b[1] - d[1];
+	f64 cdx = (f64)c[0] - d[0], cdy = (f64)c[1] - d[1];
+	f64 alift = adx * adx + ady * ady;
+	f64 blift = bdx * bdx + bdy * bdy;
+	f64 clift = cdx * cdx + cdy * cdy;
+	f64 det = alift * (bdx * cdy - cdx * bdy) +
+	          blift * (cdx * ady - adx * cdy) +
+	          clift * (adx * bdy - bdx * ady);
+	f64 permanent = alift * (fabs(bdx * cdy) + fabs(cdx * bdy)) +
+	                blift * (fabs(cdx * ady) + fabs(adx * cdy)) +
+	                clift * (fabs(adx * bdy) + fabs(bdx * ady));
+	if (fabs(det) <= inCircleErrBound * permanent) {
+		det = inCircleExact(a, b, c, d);
+	}
+	// the determinant is positive for d inside a counter-clockwise triangle:
+	return det < 0;
 }
 
 s32 Triangulation::AddPoint(f32 x, f32 y) {
-	s8 duplicate = false;
-	s8 found = false;
-	s32 parentTriIs[2] = {-1, -1};
-	s32 parentTriIsIdx = 0;
-	f32 minVertDist = FLT_MAX;
-	s32 minVertI = -1;
-	for (s32 i = 0; i < VertI; i += 2) {
-		f32 vx = Verts[i] - x;
-		f32 vy = Verts[i + 1] - y;
-		f32 vertDist = vx * vx + vy * vy;
-		if (vertDist < minVertDist) {
-			minVertI = i;
-			minVertDist = vertDist;
-		}
-	}
-#define findTriForVert(vertI)                                                  \
-	for (s32 i = 0; i < TriangleI; i += 3) {                                   \
-		if (Triangles[i] != (vertI) && Triangles[i + 1] != (vertI) &&          \
-		    Triangles[i + 2] != (vertI)) {                                     \
-			continue;                                                          \
-		}                                                                      \
-		f32 ps[8] = {x, y, Verts[Triangles[i]], Verts[Triangles[i] + 1],       \
-		             Verts[Triangles[i + 1]], Verts[Triangles[i + 1] + 1],     \
-		             Verts[Triangles[i + 2]], Verts[Triangles[i + 2] + 1]};    \
-		if (pointInTriangle(ps)) {                                             \
-			found = true;                                                      \
-			if (parentTriIsIdx < 2) {                                          \
-				parentTriIs[parentTriIsIdx] = i;                               \
-				parentTriIsIdx++;                                              \
-			} else {                                                           \
-				duplicate = true;                                              \
-				break;                                                         \
-			}                                                                  \
-		}                                                                      \
-	}
-	findTriForVert(minVertI);
-	if (!found) {
-		auto sortedVerts = (indexedVert *)malloc(8 * VertI);
-		for (s32 i = 0; i < VertI; i += 2) {
-			f32 vx = Verts[i] - x;
-			f32 vy = Verts[i + 1] - y;
-			f32 vertDist = vx * vx + vy * vy;
-			sortedVerts[i].i = i;
-			sortedVerts[i].f = vertDist;
-		}
-		qsort(sortedVerts, VertI, 8, indexedVertCompare);
-		for (s32 j = 0; j < VertI; j++) {
-			findTriForVert(sortedVerts[j].i);
-			if (found) {
+	f32 pt[2] = {x, y};
+	// find our encompassing triangle, and whether pt is on one of its edges:
+	s32 triI = -1;
+	s32 onEdge = -1;
+	s32 nOnEdges = 0;
+	for (s32 i = 0; i < TriangleI && triI < 0; i += 3) {
+		s8 inside = true;
+		onEdge = -1;
+		nOnEdges = 0;
+		for (s32 j = 0; j < 3; j++) {
+			f64 side = orient(&Verts[Triangles[i + j]],
+			                  &Verts[Triangles[i + (j + 1) % 3]], pt);
+			if (side > 0) {
+				inside = false;
 				break;
 			}
+			if (side == 0) {
+				onEdge = j;
+				nOnEdges++;
+			}
+		}
+		if (inside) {
+			triI = i;
 		}
-		free(sortedVerts);
 	}
-	if (!found) {
-		// out of bounds
-		return -1;
+	if (triI < 0) {
+		return errOutOfBounds;
 	}
-	if (duplicate) {
-		for (s32 dupI = 0; dupI < VertI; dupI += 2) {
-			f32 vx = Verts[dupI] - x;
-			f32 vy = Verts[dupI + 1] - y;
-			if (vx * vx + vy * vy < 1e-8f) {
-				return dupI;
+	for (s32 j = 0; j < 3; j++) {
+		s32 dupI = Triangles[triI + j];
+		if (Verts[dupI] == x && Verts[dupI + 1] == y) {
+			// point is a duplicate
+			return dupI;
+		}
+	}
+	if (nOnEdges > 1) {
+		// pt is on two edges, so it should have been a duplicate
+		return errDegenerateGraph;
+	}
+	s32 otherTriI = -1;
+	if (onEdge != -1) {
+		s32 a = Triangles[triI + onEdge];
+		s32 b = Triangles[triI + (onEdge + 1) % 3];
+		for (s32 n = 0; n < TriangleI; n += 3) {
+			if ((Triangles[n] == b && Triangles[n + 1] == a) ||
+			    (Triangles[n + 1] == b && Triangles[n + 2] == a) ||
+			    (Triangles[n + 2] == b && Triangles[n] == a)) {
+				otherTriI = n;
+				break;
 			}
 		}
-		return -1;
+		if (otherTriI == -1) {
+			// pt is on the boundary
+			return errOutOfBounds;
+		}
 	}
 
 	s32 ptI = VertI;
 	Verts[ptI] = x;
 	Verts[ptI + 1] = y;
 	VertI += 2;
-	checkTriI = 0;
-	if (parentTriIs[1] != -1) {
+	Vec<s32> checkTris{};
+	if (otherTriI != -1) {
 		s32 quad[4];
-		getSharedQuad(quad, parentTriIs[0], parentTriIs[1]);
+		getSharedQuad(quad, triI, otherTriI);
 		s32 edge[2] = {quad[1], quad[3]};
 		if (quad[1] > quad[3]) {
 			edge[0] = quad[3];
@@ -282,13 +404,13 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 		}
 		// generate new tris and edges
 		// 0:
-		Triangles[parentTriIs[0]] = quad[0];
-		Triangles[parentTriIs[0] + 1] = quad[1];
-		Triangles[parentTriIs[0] + 2] = ptI;
+		Triangles[triI] = quad[0];
+		Triangles[triI + 1] = quad[1];
+		Triangles[triI + 2] = ptI;
 		// 1:
-		Triangles[parentTriIs[1]] = quad[1];
-		Triangles[parentTriIs[1] + 1] = quad[2];
-		Triangles[parentTriIs[1] + 2] = ptI;
+		Triangles[otherTriI] = quad[1];
+		Triangles[otherTriI + 1] = quad[2];
+		Triangles[otherTriI + 2] = ptI;
 		// our edge sortedness is guaranteed here because ptI is the
 		// largest index
 		Edges[oldEdgeI] = quad[1];
@@ -310,15 +432,13 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 		fixed[fixedI + 0] = false;
 		fixed[fixedI + 1] = false;
 		fixed[fixedI + 2] = false;
-		checkTris[checkTriI + 0] = parentTriIs[0];
-		checkTris[checkTriI + 1] = parentTriIs[1];
-		checkTris[checkTriI + 2] = TriangleI;
-		checkTris[checkTriI + 3] = TriangleI + 3;
+		checkTris.push_back(triI);
+		checkTris.push_back(otherTriI);
+		checkTris.push_back(TriangleI);
+		checkTris.push_back(TriangleI + 3);
 		TriangleI += 6;
 		EdgeI += 6;
-		checkTriI += 4;
 	} else {
-		s32 triI = parentTriIs[0];
 		s32 triVs[3] = {Triangles[triI], Triangles[triI + 1],
 		                Triangles[triI + 2]};
 		Triangles[triI] = triVs[0];
@@ -341,15 +461,15 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 		fixed[fixedI + 0] = false;
 		fixed[fixedI + 1] = false;
 		fixed[fixedI + 2] = false;
-		checkTris[checkTriI + 0] = triI;
-		checkTris[checkTriI + 1] = TriangleI;
-		checkTris[checkTriI + 2] = TriangleI + 3;
+		checkTris.push_back(triI);
+		checkTris.push_back(TriangleI);
+		checkTris.push_back(TriangleI + 3);
 		TriangleI += 6;
 		EdgeI += 6;
-		checkTriI += 3;
 	}
-	while (checkTriI > 0) {
-		s32 triI = checkTris[0];
+	while (checkTris.size > 0) {
+		checkTris.size--;
+		s32 triI = checkTris[checkTris.size];
 		s32 triV[3] = {Triangles[triI], Triangles[triI + 1],
 		               Triangles[triI + 2]};
 		for (s32 i = 0; i < 3; i++) {
@@ -369,7 +489,7 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 			if (fixed[edgeI >> 1]) {
 				continue;
 			}
-			found = false;
+			s8 found = false;
 			s32 otherTriI = -1;
 			for (s32 n = 0; n < TriangleI; n += 3) {
 				if (n == triI) {
@@ -397,28 +517,8 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 			}
 			s32 quad[4];
 			getSharedQuad(quad, triI, otherTriI);
-			f32 sign;
-			{
-				f32 ax, bx, cx, dx, ay, by, cy, dy;
-				ax = Verts[quad[0]];
-				ay = Verts[quad[0] + 1];
-				bx = Verts[quad[1]];
-				by = Verts[quad[1] + 1];
-				cx = Verts[quad[2]];
-				cy = Verts[quad[2] + 1];
-				dx = Verts[quad[3]];
-				dy = Verts[quad[3] + 1];
-				f32 mat[16] = {//--------------------------
-				               dx, dy, dx * dx + dy * dy, 1,
-				               //--------------------------
-				               cx, cy, cx * cx + cy * cy, 1,
-				               //--------------------------
-				               bx, by, bx * bx + by * by, 1,
-				               //--------------------------
-				               ax, ay, ax * ax + ay * ay, 1};
-				sign = mat4Det(mat);
-			}
-			if (sign > 1e-7f) {
+			if (inCircle(&Verts[quad[0]], &Verts[quad[1]], &Verts[quad[3]],
+			             &Verts[quad[2]])) {
 				Triangles[triI] = quad[0];
 				Triangles[triI + 1] = quad[1];
 				Triangles[triI + 2] = quad[2];
@@ -432,22 +532,42 @@ s32 Triangulation::AddPoint(f32 x, f32 y) {
 				}
 				Edges[edgeI] = newEdge[0];
 				Edges[edgeI + 1] = newEdge[1];
-				checkTris[checkTriI + 0] = triI;
-				checkTris[checkTriI + 1] = otherTriI;
-				checkTriI += 2;
+				checkTris.push_back(triI);
+				checkTris.push_back(otherTriI);
 				break;
 			}
 		}
-		checkTris[0] = checkTris[checkTriI - 1];
-		checkTriI--;
 	}
-
 	return ptI;
 }
 
-void Triangulation::AddEdge(s32 indexA, s32 indexB) {
+// innerEdges appends to edges the sorted edges shared by two of the triangles
+// listed by triIs in tris.
+void innerEdges(Vec<s32> &edges, const s32 *tris, Vec<s32> &triIs) {
+	for (s32 i = 0; i < triIs.size; i++) {
+		for (s32 j = 0; j < 3; j++) {
+			s32 a = tris[triIs[i] + j];
+			s32 b = tris[triIs[i] + (j + 1) % 3];
+			if (a > b) {
+				continue; // counted from the other side
+			}
+			for (s32 k = 0; k < triIs.size; k++) {
+				const s32 *other = &tris[triIs[k]];
+				if ((other[0] == b && other[1] == a) ||
+				    (other[1] == b && other[2] == a) ||
+				    (other[2] == b && other[0] == a)) {
+					edges.push_back(a);
+					edges.push_back(b);
+					break;
+				}
+			}
+		}
+	}
+}
+
+s32 Triangulation::AddEdge(s32 indexA, s32 indexB) {
 	if (indexA == indexB) {
-		return;
+		return 0;
 	}
 	s32 edge[2] = {indexA, indexB};
 	if (edge[0] > edge[1]) {
@@ -463,71 +583,49 @@ void Triangulation::AddEdge(s32 indexA, s32 indexB) {
 		}
 	}
 	if (edgeExists) {
-		return;
+		return 0;
 	}
+	f32 *ptA = &Verts[edge[0]];
+	f32 *ptB = &Verts[edge[1]];
 	s32 crossedTri[3] = {-1, -1, -1};
 	s32 crossedTriI = -1;
-	for (s32 i = 0; i < TriangleI; i += 3) {
-		if (Triangles[i] == edge[0]) {
-			f32 ps[8] = {Verts[edge[1]], Verts[edge[1] + 1],
-			             Verts[Triangles[i]], Verts[Triangles[i] + 1],
-			             Verts[Triangles[i + 1]], Verts[Triangles[i + 1] + 1],
-			             Verts[Triangles[i + 2]], Verts[Triangles[i + 2] + 1]};
-			if (pointInAngle(ps)) {
-				crossedTri[0] = Triangles[i];
-				crossedTri[1] = Triangles[i + 1];
-				crossedTri[2] = Triangles[i + 2];
-				crossedTriI = i;
-				break;
+	for (s32 i = 0; i < TriangleI && crossedTriI == -1; i += 3) {
+		for (s32 j = 0; j < 3; j++) {
+			if (Triangles[i + j] != edge[0]) {
+				continue;
 			}
-		}
-		if (Triangles[i + 1] == edge[0]) {
-			f32 ps[8] = {Verts[edge[1]], Verts[edge[1] + 1],
-			             Verts[Triangles[i + 1]], Verts[Triangles[i + 1] + 1],
-			             Verts[Triangles[i + 2]], Verts[Triangles[i + 2] + 1],
-			             Verts[Triangles[i]], Verts[Triangles[i] + 1]};
-			if (pointInAngle(ps)) {
-				crossedTri[0] = Triangles[i + 1];
-				crossedTri[1] = Triangles[i + 2];
-				crossedTri[2] = Triangles[i];
-				crossedTriI = i;
-				break;
+			s32 b = Triangles[i + (j + 1) % 3];
+			s32 c = Triangles[i + (j + 2) % 3];
+			f32 *ptC = &Verts[b];
+			if (orient(ptA, ptB, ptC) == 0 &&
+			    (ptC[0] - ptA[0]) * (ptB[0] - ptA[0]) +
+			            (ptC[1] - ptA[1]) * (ptB[1] - ptA[1]) >
+			        0) {
+				// the edge runs along an existing edge to b, and then on from
+				// b:
+				AddEdge(edge[0], b);
+				return AddEdge(b, edge[1]);
 			}
-		}
-		if (Triangles[i + 2] == edge[0]) {
-			f32 ps[8] = {Verts[edge[1]], Verts[edge[1] + 1],
-			             Verts[Triangles[i + 2]], Verts[Triangles[i + 2] + 1],
-			             Verts[Triangles[i]], Verts[Triangles[i] + 1],
-			             Verts[Triangles[i + 1]], Verts[Triangles[i + 1] + 1]};
-			if (pointInAngle(ps)) {
-				crossedTri[0] = Triangles[i + 2];
-				crossedTri[1] = Triangles[i];
-				crossedTri[2] = Triangles[i + 1];
+			// the edge leaves edge[0] between b and c:
+			if (orient(ptA, &Verts[b], ptB) < 0 &&
+			    orient(ptA, &Verts[c], ptB) > 0) {
+				crossedTri[0] = edge[0];
+				crossedTri[1] = b;
+				crossedTri[2] = c;
 				crossedTriI = i;
-				break;
 			}
+			break;
 		}
 	}
 	if (crossedTriI == -1) {
-		printf("crossedTri wasn't found (%d, %d)\n", edge[0], edge[1]);
-		return;
+		return errDegenerateGraph;
 	}
-	f32 ptA[2] = {Verts[edge[0]], Verts[edge[0] + 1]};
-	f32 ptB[2] = {Verts[edge[1]], Verts[edge[1] + 1]};
 	Vec<s32> ptsU{};
 	ptsU.push_back(crossedTri[1]);
 	Vec<s32> ptsL{};
 	ptsL.push_back(crossedTri[2]);
 	Vec<s32> deadTriIs{};
 	deadTriIs.push_back(crossedTriI);
-	Vec<s32> deadEdges{};
-	newTriI = 0;
-	newEdgeI = 0;
-	Vec<s32> ringEdges{};
-	ringEdges.push_back(crossedTri[0]);
-	ringEdges.push_back(crossedTri[1]);
-	ringEdges.push_back(crossedTri[0]);
-	ringEdges.push_back(crossedTri[2]);
 	for (;;) {
 		s32 otherTriI = -1;
 		s32 otherVertI = -1;
@@ -554,180 +652,125 @@ void Triangulation::AddEdge(s32 indexA, s32 indexB) {
 				break;
 			}
 		}
+		if (otherTriI == -1) {
+			return errDegenerateGraph;
+		}
 		deadTriIs.push_back(otherTriI);
-		deadEdges.push_back(crossedTri[1]);
-		deadEdges.push_back(crossedTri[2]);
 		if (deadTriIs.size > 10000) {
-			return;
+			return errNonTermination;
 		}
 		if (otherVertI == edge[1]) {
-			ringEdges.push_back(crossedTri[1]);
-			ringEdges.push_back(otherVertI);
-			ringEdges.push_back(crossedTri[2]);
-			ringEdges.push_back(otherVertI);
 			break;
 		}
-		f32 oppositePt[2] = {Verts[otherVertI], Verts[otherVertI + 1]};
-		f32 ptSide = (ptB[0] - ptA[0]) * (oppositePt[1] - ptA[1]) -
-		             (ptB[1] - ptA[1]) * (oppositePt[0] - ptA[0]);
-		if (ptSide > 1e-12f) {
+		f64 ptSide = orient(ptA, ptB, &Verts[otherVertI]);
+		if (ptSide > 0) {
 			ptsU.push_back(otherVertI);
-			ringEdges.push_back(crossedTri[1]);
-			ringEdges.push_back(otherVertI);
 			crossedTri[0] = crossedTri[1];
 			crossedTri[1] = otherVertI;
 			crossedTriI = otherTriI;
-		} else if (ptSide < -1e-12f) {
+		} else if (ptSide < 0) {
 			ptsL.push_back(otherVertI);
-			ringEdges.push_back(crossedTri[2]);
-			ringEdges.push_back(otherVertI);
 			crossedTri[0] = crossedTri[2];
 			crossedTri[2] = otherVertI;
 			crossedTriI = otherTriI;
 		} else {
-			AddEdge(otherVertI, edge[1]);
+			s32 err = AddEdge(otherVertI, edge[1]);
+			if (err < 0) {
+				return err;
+			}
 			edge[1] = otherVertI;
 			break;
 		}
 	}
-	retriangulate(ringEdges, ptsU, edge);
-	s32 tmp = edge[0];
-	edge[0] = edge[1];
-	edge[1] = tmp;
-	retriangulate(ringEdges, ptsL, edge);
-	if (edge[0] > edge[1]) {
-		s32 tmp = edge[0];
-		edge[0] = edge[1];
-		edge[1] = tmp;
+	// the edges between dead triangles are replaced by those between the new
+	// ones:
+	Vec<s32> deadEdges{};
+	innerEdges(deadEdges, Triangles, deadTriIs);
+	newTriI = 0;
+	retriangulate(ptsU, 0, ptsU.size, edge);
+	// the lower chain runs from edge[1] to edge[0] when seen from its side:
+	for (s32 i = 0, j = ptsL.size - 1; i < j; i++, j--) {
+		s32 tmp = ptsL[i];
+		ptsL[i] = ptsL[j];
+		ptsL[j] = tmp;
 	}
-	newEdgeI -= 2;
+	s32 lowerEdge[2] = {edge[1], edge[0]};
+	retriangulate(ptsL, 0, ptsL.size, lowerEdge);
 	s32 nDeadTriIs = deadTriIs.size;
+	Vec<s32> newTriIs{};
 	for (s32 i = 0; i < nDeadTriIs; i++) {
 		Triangles[deadTriIs[i]] = newTris[3 * i];
 		Triangles[deadTriIs[i] + 1] = newTris[3 * i + 1];
 		Triangles[deadTriIs[i] + 2] = newTris[3 * i + 2];
+		newTriIs.push_back(3 * i);
 	}
+	Vec<s32> newEdges{};
+	innerEdges(newEdges, newTris, newTriIs);
 	s32 nDeadEdges = deadEdges.size;
+	// edges that are dead and new at once are left alone:
 	for (s32 i = 0; i < nDeadEdges; i += 2) {
-		s32 deadEdge[2] = {deadEdges[i], deadEdges[i + 1]};
-		if (deadEdges[i] > deadEdges[i + 1]) {
-			deadEdge[0] = deadEdges[i + 1];
-			deadEdge[1] = deadEdges[i];
+		for (s32 k = 0; k < nDeadEdges; k += 2) {
+			if (deadEdges[i] == newEdges[k] &&
+			    deadEdges[i + 1] == newEdges[k + 1]) {
+				deadEdges[i] = -1;
+				newEdges[k] = -1;
+				break;
+			}
 		}
-		s32 newEdge[2] = {newEdges[i], newEdges[i + 1]};
-		if (newEdges[i] > newEdges[i + 1]) {
-			newEdge[0] = newEdges[i + 1];
-			newEdge[1] = newEdges[i];
+	}
+	for (s32 i = 0, k = 0; i < nDeadEdges; i += 2) {
+		if (deadEdges[i] == -1) {
+			continue;
+		}
+		while (newEdges[k] == -1) {
+			k += 2;
 		}
-		s8 last = i == nDeadEdges - 2;
 		for (s32 j = 0; j < EdgeI; j += 2) {
-			if (deadEdge[0] == Edges[j] && deadEdge[1] == Edges[j + 1]) {
-				Edges[j] = newEdge[0];
-				Edges[j + 1] = newEdge[1];
-				if (last) {
-					fixed[j >> 1] = true;
-				}
+			if (deadEdges[i] == Edges[j] && deadEdges[i + 1] == Edges[j + 1]) {
+				Edges[j] = newEdges[k];
+				Edges[j + 1] = newEdges[k + 1];
+				fixed[j >> 1] = false;
 				break;
 			}
 		}
+		k += 2;
+	}
+	for (s32 j = 0; j < EdgeI; j += 2) {
+		if (Edges[j] == edge[0] && Edges[j + 1] == edge[1]) {
+			fixed[j >> 1] = true;
+			break;
+		}
 	}
+	return 0;
 }
 
-void Triangulation::retriangulate(Vec<s32> &ringEdges, Vec<s32> &vertIs,
+// retriangulate appends to newTris the Delaunay triangulation of the polygon
+// made by the edge edgeIs and the chain of vertices vertIs[lo:hi] to its left,
+// from edgeIs[0] to edgeIs[1].  The triangle on the edge takes the vertex of
+// the chain whose circumcircle with the edge contains no other vertex of the
+// chain, splitting the rest of the chain in two.
+void Triangulation::retriangulate(Vec<s32> &vertIs, s32 lo, s32 hi,
                                   s32 edgeIs[2]) {
-	s32 cI = -1;
-	s32 nVertIs = vertIs.size;
-	if (nVertIs > 1) {
-		cI = vertIs[0];
-		f32 c[2] = {Verts[cI], Verts[cI + 1]};
-		f32 a[2] = {Verts[edgeIs[0]], Verts[edgeIs[0] + 1]};
-		f32 b[2] = {Verts[edgeIs[1]], Verts[edgeIs[1] + 1]};
-		for (s32 i = 1; i < nVertIs; i++) {
-			f32 d[2] = {Verts[vertIs[i]], Verts[vertIs[i] + 1]};
-			f32 mat[16] = {a[0], a[1], a[0] * a[0] + a[1] * a[1], 1,
-			               // -------------------------------------
-			               b[0], b[1], b[0] * b[0] + b[1] * b[1], 1,
-			               // -------------------------------------
-			               c[0], c[1], c[0] * c[0] + c[1] * c[1], 1,
-			               // -------------------------------------
-			               d[0], d[1], d[0] * d[0] + d[1] * d[1], 1};
-			f32 sign = mat4Det(mat);
-			if (sign > 0.f) {
-				cI = vertIs[i];
-				c[0] = Verts[cI];
-				c[1] = Verts[cI + 1];
-			}
-		}
-		Vec<s32> leftVertIs{};
-		Vec<s32> rightVertIs{};
-		s32 ringI = edgeIs[0];
-		s32 prevRingI = -1;
-		s8 right = false;
-		s32 nRingEdges = ringEdges.size;
-		for (;;) {
-			s8 inRing = false;
-			s8 shouldBreak = false;
-			s32 testI = -1;
-			for (s32 i = 0; i < nRingEdges; i += 2) {
-				if (ringEdges[i] == ringI) {
-					testI = ringEdges[i + 1];
-				}
-				if (ringEdges[i + 1] == ringI) {
-					testI = ringEdges[i];
-				}
-				if (testI >= 0 && prevRingI != testI) {
-					inRing = false;
-					shouldBreak = false;
-					for (s32 j = 0; j < nVertIs; j++) {
-						if (vertIs[j] == testI) {
-							inRing = true;
-							shouldBreak = false;
-							break;
-						}
-					}
-					if (!inRing && (testI == edgeIs[1] || testI == edgeIs[0])) {
-						inRing = true;
-						shouldBreak = true;
-						break;
-					}
-					if (inRing) {
-						prevRingI = ringI;
-						ringI = testI;
-						if (ringI == cI) {
-							right = true;
-						} else if (right) {
-							rightVertIs.push_back(ringI);
-						} else {
-							leftVertIs.push_back(ringI);
-						}
-						break;
-					}
-				}
-			}
-			if (shouldBreak) {
-				break;
-			}
-			if (ringI == prevRingI) {
-				return;
-			}
-		}
-		s32 leftEdge[2] = {edgeIs[0], cI};
-		s32 rightEdge[2] = {cI, edgeIs[1]};
-		retriangulate(ringEdges, leftVertIs, leftEdge);
-		retriangulate(ringEdges, rightVertIs, rightEdge);
+	if (lo >= hi) {
+		return;
 	}
-	if (nVertIs > 0) {
-		if (cI == -1) {
-			cI = vertIs[0];
+	f32 *a = &Verts[edgeIs[0]];
+	f32 *b = &Verts[edgeIs[1]];
+	s32 c = lo;
+	for (s32 i = lo + 1; i < hi; i++) {
+		if (inCircle(b, a, &Verts[vertIs[c]], &Verts[vertIs[i]])) {
+			c = i;
 		}
-		newTris[newTriI + 0] = edgeIs[1];
-		newTris[newTriI + 1] = edgeIs[0];
-		newTris[newTriI + 2] = cI;
-		newEdges[newEdgeI + 0] = edgeIs[0];
-		newEdges[newEdgeI + 1] = edgeIs[1];
-		newTriI += 3;
-		newEdgeI += 2;
 	}
+	s32 cI = vertIs[c];
+	s32 leftEdge[2] = {edgeIs[0], cI};
+	s32 rightEdge[2] = {cI, edgeIs[1]};
+	retriangulate(vertIs, lo, c, leftEdge);
+	retriangulate(vertIs, c + 1, hi, rightEdge);
+	newTris[newTriI + 0] = edgeIs[1];
+	newTris[newTriI + 1] = edgeIs[0];
+	newTris[newTriI + 2] = cI;
+	newTriI += 3;
 }
 
 void Triangulation::getSharedQuad(s32 quad[4], s32 triA, s32 triB) {
@@ -1,96 +1,419 @@
 /*
 Package cdt provides an implementation of 2-dimensional Constrained Delaunay
 Triangulation.  The implementation follows the algorithm outlined at
-http://www.cescg.org/CESCG-2004/web/Domiter-Vid/index.html, but without any of
-the spatial data structures.
+http://www.cescg.org/CESCG-2004/web/Domiter-Vid/index.html.  Triangulation
+locates each new point by jumping to a nearby vertex through a bucket grid and
+walking across the triangles from there, which is fast as long as points aren't
+added in an order that sweeps across the region, such as along a circle.
+Triangulation keeps the adjacency of its triangles as half-edges, which
+callers may use to walk the mesh themselves.
 */
 package cdt
 
-// #cgo CXXFLAGS: -O3 -std=c++11 -Wall -Werror
-// #include <stdlib.h>
-// int triangulate(float left, float right, float bottom, float top,
-//                 int nPoints, float *points, int nEdges, int *edges,
-//                 float *verts, int *srcToDstIs, int *triangles);
-import "C"
-
 import (
-	"fmt"
-	"github.com/go-gl/mathgl/mgl32"
+	"errors"
 	"math"
 	"sort"
-	"unsafe"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+var (
+	// ErrOutOfBounds is returned when a point does not fall inside the
+	// triangulation's bounding rectangle.
+	ErrOutOfBounds = errors.New("cdt: point out-of-bounds")
+	// ErrDegenerateGraph is returned when the points and edges given don't
+	// describe a graph that can be triangulated, such as an edge from a point
+	// to itself.
+	ErrDegenerateGraph = errors.New("cdt: bad graph")
+	// ErrNonTermination is returned when edge insertion detects that it would
+	// otherwise loop forever.
+	ErrNonTermination = errors.New("cdt: probable infinite loop detected")
+	// ErrIntersectingEdges is returned by AddEdge, when the Triangulation's
+	// Policy is ConstraintError, for an edge that crosses a constrained edge.
+	ErrIntersectingEdges = errors.New("cdt: edge crosses a constrained edge")
+)
+
+// A ConstraintPolicy decides what AddEdge does with an edge that crosses an
+// edge added before it.
+type ConstraintPolicy int
+
+const (
+	// ConstraintLastWins removes the constrained edges that the new edge
+	// crosses.
+	ConstraintLastWins ConstraintPolicy = iota
+	// ConstraintError returns ErrIntersectingEdges.  The triangles the edge
+	// crosses are left as they were, but where it passes through vertices on
+	// the way to the crossing, the parts of it up to the last of those stay
+	// added and constrained.
+	ConstraintError
+	// ConstraintSplit adds a vertex where the edges cross, and constrains
+	// the four edges to it.
+	ConstraintSplit
 )
 
-func Triangulate(left, right, bottom, top float32,
-	points []float32, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32) {
+// A FillRule decides which regions bounded by constrained edges Classify counts
+// as inside, from their winding number: the number of edges around a region
+// running counter-clockwise, less those running clockwise.
+type FillRule int
 
-	cPoints := unsafe.Pointer(C.malloc(C.size_t(len(points) * 4)))
-	for i, f := range points {
-		p := (*float32)(unsafe.Pointer(uintptr(cPoints) + uintptr(i*4)))
-		*p = f
+const (
+	// NonZero fills the regions with a winding number other than 0.
+	NonZero FillRule = iota
+	// EvenOdd fills the regions with an odd winding number.
+	EvenOdd
+)
+
+// Bounds returns a rectangle that holds points, given as x, y pairs, strictly
+// inside it, for use with Triangulate or NewTriangulation.  The rectangle is
+// larger than the points' bounding box by a tenth of its larger side.
+func Bounds(points []float32) (left, right, bottom, top float32) {
+	if len(points) < 2 {
+		return -1, 1, -1, 1
 	}
-	cEdges := unsafe.Pointer(C.malloc(C.size_t(len(points) * 4)))
-	for i, e := range edges {
-		p := (*int32)(unsafe.Pointer(uintptr(cEdges) + uintptr(i*4)))
-		*p = e
-	}
-
-	numPoints := (len(points) / 2) + 4
-	srcToDstIs = make([]int32, len(points)/2)
-	verts = make([]float32, numPoints*2)
-	triangles = make([]int32, 3*(2*numPoints-6))
-	cSrcToDstIs := unsafe.Pointer(C.malloc(C.size_t(len(srcToDstIs) * 4)))
-	cVerts := unsafe.Pointer(C.malloc(C.size_t(len(verts) * 4)))
-	cTriangles := unsafe.Pointer(C.malloc(C.size_t(len(triangles) * 4)))
-	// fmt.Printf("triangulate(%ff, %ff, %ff, %ff, %d, %v, %d, %v, verts, triangles)\n",
-	// 	left, right, bottom, top, len(points)/2, points, len(edges)/2, edges)
-	err := C.triangulate(
-		C.float(left), C.float(right), C.float(bottom), C.float(top),
-		C.int(int32(len(points)/2)), (*C.float)(cPoints),
-		C.int(int32(len(edges)/2)), (*C.int)(cEdges),
-		(*C.float)(cVerts), (*C.int)(cSrcToDstIs), (*C.int)(cTriangles))
-	if err < 0 {
-		panic(fmt.Sprintf("triangulate failed with error %d", err))
-	}
-	C.free(cPoints)
-	C.free(cEdges)
-	for i := 0; i < len(srcToDstIs); i++ {
-		p := (*int32)(unsafe.Pointer(uintptr(cSrcToDstIs) + uintptr(i*4)))
-		srcToDstIs[i] = *p
-	}
-	C.free(cSrcToDstIs)
-	for i := 0; i < len(verts); i++ {
-		p := (*float32)(unsafe.Pointer(uintptr(cVerts) + uintptr(i*4)))
-		verts[i] = *p
-	}
-	C.free(cVerts)
-	for i := 0; i < len(triangles); i++ {
-		p := (*int32)(unsafe.Pointer(uintptr(cTriangles) + uintptr(i*4)))
-		triangles[i] = *p
-	}
-	C.free(cTriangles)
-	// truncate the result, in case of duplicates:
-	numPoints = int(err)
-	verts = verts[:numPoints]
-	triangles = triangles[:3*(numPoints-6)]
-	return verts, srcToDstIs, triangles
+	left, right = points[0], points[0]
+	bottom, top = points[1], points[1]
+	for i := 2; i+1 < len(points); i += 2 {
+		left = min(left, points[i])
+		right = max(right, points[i])
+		bottom = min(bottom, points[i+1])
+		top = max(top, points[i+1])
+	}
+	pad := 0.1 * max(right-left, top-bottom)
+	// the padding must still change coordinates far from 0:
+	largest := max(-left, right, -bottom, top)
+	pad = max(pad, 1e-5*largest)
+	if pad == 0 {
+		pad = 1
+	}
+	return left - pad, right + pad, bottom - pad, top + pad
+}
+
+// TriangulatePoints is like Triangulate, but computes the bounding rectangle
+// from points with Bounds.  If corners is false, the four corners of the
+// rectangle, and the triangles that use them, are left out of the result,
+// leaving the triangulation of the convex hull of points, and indices into
+// verts start from the first point instead.  The sides of the hull are then
+// constrained, since a corner can fall inside the circumcircle of a thin
+// triangle along the hull and flip its side away.
+func TriangulatePoints(points []float32, edges []int32,
+	corners bool) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+
+	left, right, bottom, top := Bounds(points)
+	if !corners {
+		edges = append(hullEdges(points), edges...)
+	}
+	verts, srcToDstIs, triangles, err = Triangulate(left, right, bottom, top, points, edges)
+	if err != nil || corners {
+		return verts, srcToDstIs, triangles, err
+	}
+	// the corners are the first 4 vertices, and no point is a corner:
+	for i := range srcToDstIs {
+		srcToDstIs[i] -= 8
+	}
+	kept := triangles[:0]
+	for i := 0; i < len(triangles); i += 3 {
+		if triangles[i] >= 8 && triangles[i+1] >= 8 && triangles[i+2] >= 8 {
+			kept = append(kept, triangles[i]-8, triangles[i+1]-8, triangles[i+2]-8)
+		}
+	}
+	return verts[8:], srcToDstIs, kept, nil
+}
+
+// hullEdges returns the edges around the convex hull of points, as pairs of
+// indices of points, with Andrew's monotone chain.  Points along the sides of
+// the hull are kept in it, so that no edge passes through a vertex.
+func hullEdges(points []float32) []int32 {
+	order := make([]int32, 0, len(points)/2)
+	for i := 0; i+1 < len(points); i += 2 {
+		order = append(order, int32(i/2))
+	}
+	point := func(i int32) mgl64.Vec2 {
+		return mgl64.Vec2{float64(points[2*i]), float64(points[2*i+1])}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := point(order[i]), point(order[j])
+		return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+	})
+	// duplicates are the same vertex, and an edge between them is degenerate:
+	unique := order[:0]
+	for _, i := range order {
+		if len(unique) == 0 || point(unique[len(unique)-1]) != point(i) {
+			unique = append(unique, i)
+		}
+	}
+	var edges []int32
+	chain := func(order []int32) {
+		hull := []int32{}
+		for _, i := range order {
+			for len(hull) >= 2 &&
+				orient(point(hull[len(hull)-2]), point(hull[len(hull)-1]), point(i)) < 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, i)
+		}
+		for k := 0; k+1 < len(hull); k++ {
+			edges = append(edges, hull[k], hull[k+1])
+		}
+	}
+	// the lower hull from left to right, then the upper from right to left:
+	chain(unique)
+	for i, j := 0, len(unique)-1; i < j; i, j = i+1, j-1 {
+		unique[i], unique[j] = unique[j], unique[i]
+	}
+	chain(unique)
+	return edges
+}
+
+// Triangulate64 is like Triangulate, but takes float64 coordinates, and the
+// triangulation is computed from them exactly; only the returned verts are
+// rounded to float32.  Triangulate64 always uses the Go implementation.
+func Triangulate64(left, right, bottom, top float64,
+	points []float64, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+	return triangulate64(left, right, bottom, top, points, edges)
+}
+
+// TriangulateFixed is like Triangulate64, but takes integer coordinates, such
+// as font units, which are triangulated exactly and then multiplied by scale
+// in the returned verts.
+func TriangulateFixed(left, right, bottom, top int32, points []int32, edges []int32,
+	scale float64) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+
+	points64 := make([]float64, len(points))
+	for i, p := range points {
+		points64[i] = float64(p)
+	}
+	t, added, err := build(
+		float64(left), float64(right), float64(bottom), float64(top), points64, edges)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	e := t.newExport(added, true)
+	// the vertices are scaled from t, where they're exact, so that they're
+	// only rounded once:
+	for v, dstI := range e.dstIs {
+		e.verts[dstI] = float32(t.Verts[v][0] * scale)
+		e.verts[dstI+1] = float32(t.Verts[v][1] * scale)
+	}
+	return e.verts, e.srcToDstIs, e.triangles(t.allTriangles()), nil
+}
+
+// triangulate is the Go implementation of Triangulate.
+func triangulate(left, right, bottom, top float32,
+	points []float32, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+
+	points64 := make([]float64, len(points))
+	for i, p := range points {
+		points64[i] = float64(p)
+	}
+	return triangulate64(float64(left), float64(right), float64(bottom), float64(top),
+		points64, edges)
+}
+
+// triangulate64 is the Go implementation of Triangulate64.
+func triangulate64(left, right, bottom, top float64,
+	points []float64, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+
+	t, added, err := build(left, right, bottom, top, points, edges)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	e := t.newExport(added, true)
+	return e.verts, e.srcToDstIs, e.triangles(t.allTriangles()), nil
+}
+
+// allTriangles returns the index in Triangles of every triangle.
+func (t *Triangulation) allTriangles() []int {
+	all := make([]int, 0, t.TriangleI/3)
+	for triI := 0; triI < t.TriangleI; triI += 3 {
+		all = append(all, triI)
+	}
+	return all
+}
+
+// TriangulateFill is like TriangulatePoints, but also splits the triangles in
+// to those inside the regions that the edges fill according to rule, and those
+// outside, as Triangulation.Classify does.  Without the corners, exterior
+// leaves out the triangles that use them, which are always outside.
+// TriangulateFill always uses the Go implementation.
+func TriangulateFill(points []float32, edges []int32, rule FillRule,
+	corners bool) (verts []float32, srcToDstIs []int32, interior, exterior []int32, err error) {
+
+	left, right, bottom, top := Bounds(points)
+	points64 := make([]float64, len(points))
+	for i, p := range points {
+		points64[i] = float64(p)
+	}
+	t, added, err := build(float64(left), float64(right), float64(bottom), float64(top),
+		points64, edges)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	in, out := t.Classify(rule)
+	e := t.newExport(added, corners)
+	return e.verts, e.srcToDstIs, e.triangles(in), e.triangles(out), nil
+}
+
+// build returns a new Triangulation of points and edges, and the index in it
+// of each point.  Points are added in a random order, since points along a
+// contour, in order, are the worst case for incremental insertion.
+func build(left, right, bottom, top float64,
+	points []float64, edges []int32) (t *Triangulation, added []int, err error) {
+
+	n := len(points) / 2
+	t = NewTriangulation(left, right, bottom, top, n)
+	order := make([]int, n)
+	for i := range order {
+		j := int(t.random() % uint32(i+1))
+		order[i] = order[j]
+		order[j] = i
+	}
+	added = make([]int, n)
+	for _, i := range order {
+		if added[i], err = t.AddPoint(points[2*i], points[2*i+1]); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i := 0; i+1 < len(edges); i += 2 {
+		if err := t.AddEdge(added[edges[i]], added[edges[i+1]]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return t, added, nil
+}
+
+// An export holds the vertices of a Triangulation renumbered to the order of
+// the points it was built from, so that the result doesn't depend on the
+// insertion order, as x, y pairs rounded to float32.
+type export struct {
+	t          *Triangulation
+	verts      []float32
+	srcToDstIs []int32
+	// dstIs holds the index in verts of each vertex, or -1 for a corner that
+	// was left out.
+	dstIs []int32
+}
+
+// newExport numbers the vertices of t, starting with the corners if corners
+// is true, and then the vertices added holds for each point.
+func (t *Triangulation) newExport(added []int, corners bool) *export {
+	e := &export{t: t, dstIs: make([]int32, t.VertI)}
+	for i := range e.dstIs {
+		e.dstIs[i] = -1
+	}
+	e.verts = make([]float32, 0, 2*t.VertI)
+	if corners {
+		for v := 0; v < 4; v++ {
+			e.number(v)
+		}
+	}
+	e.srcToDstIs = make([]int32, len(added))
+	for i, v := range added {
+		e.srcToDstIs[i] = e.number(v)
+	}
+	// any other vertices were added where constraints cross:
+	for v := 4; v < t.VertI; v++ {
+		e.number(v)
+	}
+	return e
+}
+
+// number returns the index in verts of the vertex v, adding it if needed.
+func (e *export) number(v int) int32 {
+	if e.dstIs[v] < 0 {
+		e.dstIs[v] = int32(len(e.verts))
+		e.verts = append(e.verts, float32(e.t.Verts[v][0]), float32(e.t.Verts[v][1]))
+	}
+	return e.dstIs[v]
+}
+
+// triangles returns the triangles at the indices triIs in Triangles, as
+// indices into verts, leaving out those that use a corner that was left out.
+func (e *export) triangles(triIs []int) []int32 {
+	triangles := make([]int32, 0, 3*len(triIs))
+	for _, triI := range triIs {
+		a := e.dstIs[e.t.Triangles[triI]]
+		b := e.dstIs[e.t.Triangles[triI+1]]
+		c := e.dstIs[e.t.Triangles[triI+2]]
+		if a >= 0 && b >= 0 && c >= 0 {
+			triangles = append(triangles, a, b, c)
+		}
+	}
+	return triangles
 }
 
 type Triangulation struct {
-	Verts []mgl32.Vec2
+	Verts []mgl64.Vec2
 	// Edge pairs are always stored with the smaller vert index first
 	Edges []int
 	// Triangles are always stored with clockwise winding
 	Triangles []int
-	// This isn't currently enforced, but could be useful for error checking
+	// Halfedges holds the adjacency of Triangles.  Each index e into
+	// Triangles also names the half-edge from the vertex Triangles[e] to the
+	// next vertex of the same triangle, and Halfedges[e] is the opposite
+	// half-edge in the neighbouring triangle, or -1 if e is on the boundary.
+	// The triangle of e is at e - e%3.
+	Halfedges []int
+	// Policy decides what AddEdge does with crossing edges.
+	Policy ConstraintPolicy
+	// fixed marks the constrained edges, indexed by the index in Edges / 2:
+	// the edges given to AddEdge and the sides of the bounding rectangle.
+	// AddPoint never flips them away, and splits them in two when a point
+	// falls on one.
 	fixed []bool
+	// winding counts the times each edge was given to AddEdge from
+	// Edges[edgeI] to Edges[edgeI+1], less the times from Edges[edgeI+1] to
+	// Edges[edgeI], indexed like fixed.
+	winding []int
+
+	// edgeOf holds the index in Edges of each half-edge's edge, and vertEdge
+	// holds a half-edge leaving each vertex.
+	edgeOf   []int
+	vertEdge []int
+	// grid buckets the area of the triangulation, holding the last vertex
+	// added in each cell, or -1, so that Locate can start near a point.
+	grid                 []int
+	gridSize             int
+	gridOrigin, gridStep mgl64.Vec2
+	// state of the generator used to sample vertices in Locate
+	seed uint32
 
 	// Used for edge insertion:
-	newTris, newEdges []int
-	checkTris         []int
+	newTris   []int
+	checkTris []int
+	// splitDepth counts the calls to splitEdges in progress:
+	splitDepth int
+	// scratch space for replaceTriangles:
+	// replaced marks the triangles being replaced, indexed by the index in
+	// Triangles / 3, with the number of the call to replaceTriangles.
+	replaced []int
+	replaceN int
+	// outside holds the half-edges around the triangles replaced, and
+	// outsideAt, insideAt and freeAt find by their vertices those half-edges,
+	// the half-edges inside the triangles replacing them that are waiting for
+	// their twins, and the edges inside the triangles replaced, which
+	// takeEdge reuses.  freeQueues holds the edges inside in order, those
+	// that aren't fixed and then those that are.
+	outside                     []outsideEdge
+	outsideAt, insideAt, freeAt edgeTable
+	freeQueues                  [2]edgeQueue
 	// Indices:
-	VertI, EdgeI, TriangleI      int
-	newTriI, newEdgeI, checkTriI int
+	VertI, EdgeI, TriangleI int
+	newTriI                 int
+}
+
+// An outsideEdge is a half-edge around the triangles being replaced by
+// replaceTriangles, seen from inside: twin is the half-edge outside, and
+// edgeI the index of its edge in Edges.
+type outsideEdge struct {
+	twin, edgeI int
+}
+
+// An edgeQueue holds indices in Edges, of which those before head have been
+// taken.
+type edgeQueue struct {
+	edgeIs []int
+	head   int
 }
 
 // NewTriangulation returns a new Triangulation initialized for performing
@@ -98,16 +421,18 @@ type Triangulation struct {
 // left and right on the X axis and by bottom and top on the Y axis.  Points
 // added to the triangulation should exist within the boundary defined by left,
 // right, bottom, and top, and they should not fall directly on the edges of or
-// outside of this rectangle.
-func NewTriangulation(left, right, bottom, top float32, numPoints int) *Triangulation {
+// outside of this rectangle; Bounds returns such a rectangle for a set of
+// points.  Space is preallocated for numPoints points, and grows when more
+// vertices are added, such as where ConstraintSplit splits edges.
+func NewTriangulation(left, right, bottom, top float64, numPoints int) *Triangulation {
 	result := &Triangulation{}
 	numPoints += 4
 	// Preallocate everything according to maximum theoretical size
-	result.Verts = make([]mgl32.Vec2, numPoints)
-	result.Verts[0] = mgl32.Vec2{left, bottom}
-	result.Verts[1] = mgl32.Vec2{left, top}
-	result.Verts[2] = mgl32.Vec2{right, bottom}
-	result.Verts[3] = mgl32.Vec2{right, top}
+	result.Verts = make([]mgl64.Vec2, numPoints)
+	result.Verts[0] = mgl64.Vec2{left, bottom}
+	result.Verts[1] = mgl64.Vec2{left, top}
+	result.Verts[2] = mgl64.Vec2{right, bottom}
+	result.Verts[3] = mgl64.Vec2{right, top}
 	result.VertI = 4
 	result.Edges = make([]int, 2*(3*numPoints-7))
 	result.Edges[0] = 0
@@ -122,12 +447,13 @@ func NewTriangulation(left, right, bottom, top float32, numPoints int) *Triangul
 	result.Edges[9] = 3
 	result.EdgeI = 10
 	result.Triangles = make([]int, 3*(2*numPoints-6))
-	result.Triangles[0] = 0
-	result.Triangles[1] = 1
-	result.Triangles[2] = 2
-	result.Triangles[3] = 2
-	result.Triangles[4] = 1
-	result.Triangles[5] = 3
+	result.Halfedges = make([]int, 3*(2*numPoints-6))
+	result.edgeOf = make([]int, 3*(2*numPoints-6))
+	result.vertEdge = make([]int, numPoints)
+	copy(result.Triangles, []int{0, 1, 2, 2, 1, 3})
+	copy(result.Halfedges, []int{-1, 3, -1, 1, -1, -1})
+	copy(result.edgeOf, []int{0, 4, 2, 4, 6, 8})
+	copy(result.vertEdge, []int{0, 1, 3, 5})
 	result.TriangleI = 6
 	result.fixed = make([]bool, 3*numPoints-7)
 	result.fixed[0] = true
@@ -135,627 +461,744 @@ func NewTriangulation(left, right, bottom, top float32, numPoints int) *Triangul
 	result.fixed[2] = false
 	result.fixed[3] = true
 	result.fixed[4] = true
+	result.winding = make([]int, 3*numPoints-7)
+	// about two vertices per cell:
+	result.gridSize = int(math.Ceil(math.Sqrt(float64(numPoints) / 2)))
+	result.grid = make([]int, result.gridSize*result.gridSize)
+	for i := range result.grid {
+		result.grid[i] = -1
+	}
+	result.gridOrigin = mgl64.Vec2{left, bottom}
+	result.gridStep = mgl64.Vec2{
+		(right - left) / float64(result.gridSize),
+		(top - bottom) / float64(result.gridSize)}
+	result.seed = 1
 	result.newTris = make([]int, 3*(2*numPoints-6))
-	result.newEdges = make([]int, 2*(3*numPoints-7))
-	result.checkTris = make([]int, 3*numPoints-7)
+	result.replaced = make([]int, 2*numPoints-6)
 	return result
 }
 
-// AddPoint inserts the point defined by x and y in to the triangulation.  The
-// returned index can be used to add edges involving this point to the
-// constrained triangulation after all points have been added.
-func (t *Triangulation) AddPoint(x, y float32) (index int) {
-	pt := mgl32.Vec2{x, y}
-	// find our encompassing triangle: (linear search cause honestly)
-	duplicate := false
-	found := false
-	parentTriIs := [2]int{-1, -1}
-	parentTriIsIdx := 0
+// reserveVertex makes room for one more vertex, and the two triangles and
+// three edges that AddPoint adds with it.
+func (t *Triangulation) reserveVertex() {
+	if t.VertI < len(t.Verts) && t.TriangleI+6 <= len(t.Triangles) &&
+		t.EdgeI+6 <= len(t.Edges) {
+		return
+	}
+	t.Verts = grow(t.Verts, t.VertI+1)
+	t.vertEdge = grow(t.vertEdge, t.VertI+1)
+	t.Triangles = grow(t.Triangles, t.TriangleI+6)
+	t.Halfedges = grow(t.Halfedges, t.TriangleI+6)
+	t.edgeOf = grow(t.edgeOf, t.TriangleI+6)
+	// edge insertion replaces triangles with as many new ones:
+	t.newTris = grow(t.newTris, t.TriangleI+6)
+	t.replaced = grow(t.replaced, t.TriangleI/3+2)
+	t.Edges = grow(t.Edges, t.EdgeI+6)
+	t.fixed = grow(t.fixed, t.EdgeI/2+3)
+	t.winding = grow(t.winding, t.EdgeI/2+3)
+}
 
-	minVertDist := float32(math.MaxFloat32)
-	minVertI := -1
-	for i := 0; i < t.VertI; i++ {
-		v := pt.Sub(t.Verts[i])
-		vertDist := v[0]*v[0] + v[1]*v[1]
-		if vertDist < minVertDist {
-			minVertI = i
-			minVertDist = vertDist
+// grow returns s lengthened to at least n, doubling its length when it's too
+// short.
+func grow[T any](s []T, n int) []T {
+	if n <= len(s) {
+		return s
+	}
+	return append(s, make([]T, max(n, 2*len(s))-len(s))...)
+}
+
+// NextHalfedge returns the half-edge following e around its triangle.
+func NextHalfedge(e int) int {
+	if e%3 == 2 {
+		return e - 2
+	}
+	return e + 1
+}
+
+// PrevHalfedge returns the half-edge preceding e around its triangle.
+func PrevHalfedge(e int) int {
+	if e%3 == 0 {
+		return e + 2
+	}
+	return e - 1
+}
+
+// Halfedge returns the half-edge from vertex a to vertex b, or -1 if there
+// isn't one.
+func (t *Triangulation) Halfedge(a, b int) int {
+	for _, e := range t.HalfedgesAround(a) {
+		if t.Triangles[NextHalfedge(e)] == b {
+			return e
 		}
 	}
+	return -1
+}
 
-	// note: making this a function to avoid copypasta kills perf
-	// note: just use c
-	for i := 0; i < t.TriangleI; i += 3 {
-		if t.Triangles[i] != minVertI &&
-			t.Triangles[i+1] != minVertI &&
-			t.Triangles[i+2] != minVertI {
+// HalfedgesAround returns the half-edges leaving vertex v, one for each
+// triangle that v belongs to, in counter-clockwise order around v.
+func (t *Triangulation) HalfedgesAround(v int) []int {
+	start := t.vertEdge[v]
+	edges := []int{start}
+	// turn one way, from each half-edge leaving v to the one leaving v in the
+	// neighbouring triangle:
+	e := start
+	for {
+		in := t.Halfedges[e]
+		if in < 0 {
+			break
+		}
+		e = NextHalfedge(in)
+		if e == start {
+			return edges
+		}
+		edges = append(edges, e)
+	}
+	// we hit the boundary, so turn the other way too:
+	e = start
+	for {
+		out := t.Halfedges[PrevHalfedge(e)]
+		if out < 0 {
+			break
+		}
+		e = out
+		edges = append([]int{e}, edges...)
+	}
+	return edges
+}
 
-			continue
+// TrianglesAround returns the indices in Triangles of the triangles that have
+// vertex v as a vertex.
+func (t *Triangulation) TrianglesAround(v int) []int {
+	edges := t.HalfedgesAround(v)
+	for i, e := range edges {
+		edges[i] = e - e%3
+	}
+	return edges
+}
+
+// IsConstrained returns true if the edge at index edgeI in Edges, that is
+// Edges[edgeI] and Edges[edgeI+1], is a side of the bounding rectangle or was
+// added by AddEdge.
+func (t *Triangulation) IsConstrained(edgeI int) bool {
+	return t.fixed[edgeI/2]
+}
+
+// Winding returns the number of times the edge at index edgeI in Edges was
+// added by AddEdge from Edges[edgeI] to Edges[edgeI+1], less the number of
+// times it was added the other way.  Parts of an edge split by a vertex keep
+// its winding.
+func (t *Triangulation) Winding(edgeI int) int {
+	return t.winding[edgeI/2]
+}
+
+// constrain fixes the edge at index edgeI in Edges, and adds winding to it in
+// the direction from the vertex from.
+func (t *Triangulation) constrain(edgeI, from, winding int) {
+	t.fixed[edgeI/2] = true
+	if t.Edges[edgeI] == from {
+		t.winding[edgeI/2] += winding
+	} else {
+		t.winding[edgeI/2] -= winding
+	}
+}
+
+// Classify sorts the triangles, by their indices in Triangles, in to those
+// inside the regions that the edges added by AddEdge fill according to rule,
+// and those outside.  The winding number of each region is found by a flood
+// fill from the bounding rectangle, which is outside, so the edges should form
+// closed loops; an edge added in both directions bounds nothing.
+func (t *Triangulation) Classify(rule FillRule) (interior, exterior []int) {
+	winding := make([]int, t.TriangleI/3)
+	seen := make([]bool, t.TriangleI/3)
+	stack := []int{}
+	for e := 0; e < t.TriangleI; e++ {
+		if triI := e - e%3; t.Halfedges[e] < 0 && !seen[triI/3] {
+			seen[triI/3] = true
+			stack = append(stack, triI)
 		}
-		if pointInTriangle(pt,
-			t.Verts[t.Triangles[i]],
-			t.Verts[t.Triangles[i+1]],
-			t.Verts[t.Triangles[i+2]]) {
-			found = true
-			if parentTriIsIdx < 2 {
-				parentTriIs[parentTriIsIdx] = i
-				parentTriIsIdx++
-			} else {
-				duplicate = true
-				break
+	}
+	for len(stack) > 0 {
+		triI := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for e := triI; e < triI+3; e++ {
+			twin := t.Halfedges[e]
+			if twin < 0 || seen[twin/3] {
+				continue
+			}
+			// triI is to the right of e, so crossing an edge along e enters
+			// the region to its left:
+			edgeI := t.edgeOf[e]
+			w := t.winding[edgeI/2]
+			if t.Edges[edgeI] != t.Triangles[e] {
+				w = -w
 			}
+			winding[twin/3] = winding[triI/3] + w
+			seen[twin/3] = true
+			stack = append(stack, twin-twin%3)
 		}
 	}
-	if !found {
-		vertDists := make([]float32, t.VertI)
-		sortedVertIs := make([]int, t.VertI)
-		for i := 0; i < t.VertI; i++ {
-			v := pt.Sub(t.Verts[i])
-			vertDists[i] = v[0]*v[0] + v[1]*v[1]
-			sortedVertIs[i] = i
-		}
-		sorter := indexedFloatSorter{vertDists, sortedVertIs, t.VertI}
-		sort.Sort(&sorter)
-
-		for j := 0; j < sorter.l; j++ {
-			n := sorter.is[j]
-			for i := 0; i < t.TriangleI; i += 3 {
-				if t.Triangles[i] != n && t.Triangles[i+1] != n && t.Triangles[i+2] != n {
-					continue
+	for triI := 0; triI < t.TriangleI; triI += 3 {
+		w := winding[triI/3]
+		if rule == NonZero && w != 0 || rule == EvenOdd && w%2 != 0 {
+			interior = append(interior, triI)
+		} else {
+			exterior = append(exterior, triI)
+		}
+	}
+	return interior, exterior
+}
+
+// findEdge returns the index in Edges of the edge between a and b, or -1 if
+// there isn't one.
+func (t *Triangulation) findEdge(a, b int) int {
+	if e := t.Halfedge(a, b); e >= 0 {
+		return t.edgeOf[e]
+	}
+	if e := t.Halfedge(b, a); e >= 0 {
+		return t.edgeOf[e]
+	}
+	return -1
+}
+
+// replaceTriangles stores the clockwise triangles tris, given as a flat list
+// of vertex triples, at the indices in Triangles given by triIs.  Indices
+// below TriangleI replace the triangles there, and the triangles replaced must
+// cover the same area as tris.  The half-edges of tris are linked to each
+// other and to the triangles around them, and the edges inside tris take the
+// indices in Edges of the edges inside the triangles replaced, followed by new
+// ones.
+func (t *Triangulation) replaceTriangles(triIs, tris []int) {
+	t.outsideAt.reset(3 * len(triIs))
+	t.insideAt.reset(3 * len(triIs))
+	t.freeAt.reset(3 * len(triIs))
+	t.replaceN++
+	for _, triI := range triIs {
+		if triI < t.TriangleI {
+			t.replaced[triI/3] = t.replaceN
+		}
+	}
+	t.outside = t.outside[:0]
+	for _, triI := range triIs {
+		if triI >= t.TriangleI {
+			continue
+		}
+		for e := triI; e < triI+3; e++ {
+			twin := t.Halfedges[e]
+			if twin >= 0 && t.replaced[twin/3] == t.replaceN {
+				if e < twin {
+					t.freeEdge(t.edgeOf[e])
 				}
-				if pointInTriangle(pt,
-					t.Verts[t.Triangles[i]],
-					t.Verts[t.Triangles[i+1]],
-					t.Verts[t.Triangles[i+2]]) {
-					found = true
-					if parentTriIsIdx < 2 {
-						parentTriIs[parentTriIsIdx] = i
-						parentTriIsIdx++
-					} else {
-						duplicate = true
-						break
-					}
+				continue
+			}
+			t.outsideAt.put(t.Triangles[e], t.Triangles[NextHalfedge(e)], len(t.outside))
+			t.outside = append(t.outside, outsideEdge{twin, t.edgeOf[e]})
+		}
+	}
+
+	for i, triI := range triIs {
+		copy(t.Triangles[triI:triI+3], tris[3*i:3*i+3])
+		t.TriangleI = max(t.TriangleI, triI+3)
+	}
+	for _, triI := range triIs {
+		for e := triI; e < triI+3; e++ {
+			a, b := t.Triangles[e], t.Triangles[NextHalfedge(e)]
+			t.vertEdge[a] = e
+			if i := t.outsideAt.get(a, b); i >= 0 {
+				o := t.outside[i]
+				t.Halfedges[e] = o.twin
+				if o.twin >= 0 {
+					t.Halfedges[o.twin] = e
 				}
+				t.edgeOf[e] = o.edgeI
+				continue
 			}
-			if found {
-				// the first vert that has any tris containing us will have all
-				// the tris
-				break
+			// the edge is inside, so the twin is in tris, and has its edge
+			// if it came first:
+			if f := t.insideAt.get(b, a); f >= 0 {
+				t.Halfedges[e] = f
+				t.Halfedges[f] = e
+				t.edgeOf[e] = t.edgeOf[f]
+			} else {
+				t.insideAt.put(a, b, e)
+				t.edgeOf[e] = t.takeEdge(a, b)
+			}
+		}
+	}
+	for i := range t.freeQueues {
+		t.freeQueues[i] = edgeQueue{t.freeQueues[i].edgeIs[:0], 0}
+	}
+}
+
+// freeEdge adds the edge at edgeI in Edges to those that takeEdge reuses.
+func (t *Triangulation) freeEdge(edgeI int) {
+	t.freeAt.put(t.Edges[edgeI], t.Edges[edgeI+1], edgeI)
+	q := &t.freeQueues[0]
+	if t.fixed[edgeI/2] {
+		q = &t.freeQueues[1]
+	}
+	q.edgeIs = append(q.edgeIs, edgeI)
+}
+
+// popFreeEdge removes and returns the first free edge that isn't fixed, or
+// failing that the first that is, or -1 if there are none.
+func (t *Triangulation) popFreeEdge() int {
+	for i := range t.freeQueues {
+		q := &t.freeQueues[i]
+		for q.head < len(q.edgeIs) {
+			edgeI := q.edgeIs[q.head]
+			q.head++
+			// edges already taken by their vertices are still queued:
+			a, b := t.Edges[edgeI], t.Edges[edgeI+1]
+			if t.freeAt.get(a, b) == edgeI {
+				t.freeAt.put(a, b, -1)
+				return edgeI
+			}
+		}
+	}
+	return -1
+}
+
+// takeEdge returns the index in Edges for a new edge between a and b inside
+// the triangles being stored by replaceTriangles.  An edge between a and b
+// that was replaced is kept as it was; otherwise the index of a replaced edge,
+// preferably one that isn't fixed, is reused, or a new one is added.
+func (t *Triangulation) takeEdge(a, b int) int {
+	a, b = min(a, b), max(a, b)
+	if edgeI := t.freeAt.get(a, b); edgeI >= 0 {
+		t.freeAt.put(a, b, -1)
+		return edgeI
+	}
+	edgeI := t.popFreeEdge()
+	if edgeI < 0 {
+		edgeI = t.EdgeI
+		t.EdgeI += 2
+	}
+	t.Edges[edgeI] = a
+	t.Edges[edgeI+1] = b
+	t.fixed[edgeI/2] = false
+	t.winding[edgeI/2] = 0
+	return edgeI
+}
+
+// random returns the next number from a xorshift generator, so that the
+// sampling in Locate is the same from run to run.
+func (t *Triangulation) random() uint32 {
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 17
+	t.seed ^= t.seed << 5
+	return t.seed
+}
+
+// gridCell returns the cell of the grid that pt falls in, clamped to the grid.
+func (t *Triangulation) gridCell(pt mgl64.Vec2) (x, y int) {
+	x = int((pt[0] - t.gridOrigin[0]) / t.gridStep[0])
+	y = int((pt[1] - t.gridOrigin[1]) / t.gridStep[1])
+	x = min(max(x, 0), t.gridSize-1)
+	y = min(max(y, 0), t.gridSize-1)
+	return x, y
+}
+
+// Locate returns the index in Triangles of a triangle containing the point
+// defined by x and y, or -1 if the point is outside of the triangulation.  It
+// jumps to a vertex near the point and walks across the triangulation from
+// there.  The vertex is the nearest of the most recently added vertex, those
+// in the grid cells around the point, and, when those are empty, a random
+// sample of about the cube root of the number of vertices.
+func (t *Triangulation) Locate(x, y float64) int {
+	pt := mgl64.Vec2{x, y}
+	best := t.VertI - 1
+	bestDist := pt.Sub(t.Verts[best]).LenSqr()
+	consider := func(v int) {
+		if d := pt.Sub(t.Verts[v]).LenSqr(); d < bestDist {
+			best = v
+			bestDist = d
+		}
+	}
+	cx, cy := t.gridCell(pt)
+	found := false
+	for y := max(cy-1, 0); y <= min(cy+1, t.gridSize-1); y++ {
+		for x := max(cx-1, 0); x <= min(cx+1, t.gridSize-1); x++ {
+			if v := t.grid[y*t.gridSize+x]; v >= 0 {
+				consider(v)
+				found = true
 			}
 		}
 	}
 	if !found {
-		// todo: handle this and other panics as a returned error
-		panic("point out-of-bounds")
-	}
-	if duplicate {
-		// point is a duplicate
-		for dupI := 0; dupI < t.VertI; dupI++ {
-			if t.Verts[dupI].Sub(mgl32.Vec2{x, y}).Len() < 1e-6 {
-				return dupI
+		samples := int(math.Cbrt(float64(t.VertI)))
+		for i := 0; i < samples; i++ {
+			consider(int(t.random() % uint32(t.VertI)))
+		}
+	}
+
+	e := t.vertEdge[best]
+	triI := e - e%3
+	for steps := 0; steps < t.TriangleI; steps++ {
+		next := -1
+		// starting from a random edge keeps the walk from cycling:
+		first := int(t.random() % 3)
+		for j := 0; j < 3; j++ {
+			e := triI + (first+j)%3
+			a := t.Triangles[e]
+			b := t.Triangles[NextHalfedge(e)]
+			if orient(t.Verts[a], t.Verts[b], pt) > 0 {
+				// pt is on the far side of ab:
+				twin := t.Halfedges[e]
+				if twin < 0 {
+					return -1
+				}
+				next = twin - twin%3
+				break
 			}
 		}
-		// this shouldn't be reached:
-		return -1
+		if next < 0 {
+			return triI
+		}
+		triI = next
+	}
+	// the walk should always terminate, but don't rely on it:
+	for i := 0; i < t.TriangleI; i += 3 {
+		a := t.Verts[t.Triangles[i]]
+		b := t.Verts[t.Triangles[i+1]]
+		c := t.Verts[t.Triangles[i+2]]
+		if orient(a, b, pt) <= 0 && orient(b, c, pt) <= 0 && orient(c, a, pt) <= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddPoint inserts the point defined by x and y in to the triangulation.  The
+// returned index can be used to add edges involving this point to the
+// constrained triangulation after all points have been added.  If the point
+// falls outside of the triangulation's bounds, ErrOutOfBounds is returned.
+func (t *Triangulation) AddPoint(x, y float64) (index int, err error) {
+	pt := mgl64.Vec2{x, y}
+	// find our encompassing triangle, and whether pt is on one of its edges
+	// or vertices:
+	triI := t.Locate(x, y)
+	if triI < 0 {
+		return -1, ErrOutOfBounds
+	}
+	for j := 0; j < 3; j++ {
+		if dupI := t.Triangles[triI+j]; t.Verts[dupI] == pt {
+			// point is a duplicate
+			return dupI, nil
+		}
+	}
+	onEdge := -1
+	for e := triI; e < triI+3; e++ {
+		a := t.Triangles[e]
+		b := t.Triangles[NextHalfedge(e)]
+		if orient(t.Verts[a], t.Verts[b], pt) != 0 {
+			continue
+		}
+		if onEdge != -1 {
+			// pt is on two edges, so it should have been a duplicate
+			return -1, ErrDegenerateGraph
+		}
+		if t.Halfedges[e] < 0 {
+			// pt is on the boundary
+			return -1, ErrOutOfBounds
+		}
+		onEdge = e
 	}
+
+	t.reserveVertex()
 	ptI := t.VertI
 	t.Verts[ptI] = pt
 	t.VertI++
-	// indices into the dirty set of t.Triangles:
-	t.checkTriI = 0
-	if parentTriIs[1] != -1 {
+	cx, cy := t.gridCell(pt)
+	t.grid[cy*t.gridSize+cx] = ptI
+	newTriI := t.TriangleI
+	if onEdge != -1 {
 		// split 2 tris => 4 tris
-		// find the clockwise quad points:
-		quad := t.getSharedQuad(parentTriIs[0], parentTriIs[1])
-		// sorted common edge:
-		edge := [2]int{quad[1], quad[3]}
-		if quad[1] > quad[3] {
-			edge = [2]int{quad[3], quad[1]}
-		}
-		// find old edge
-		oldEdgeI := -1
-		for i := 0; i < t.EdgeI; i += 2 {
-			if t.Edges[i] == edge[0] && t.Edges[i+1] == edge[1] {
-				oldEdgeI = i
-				break
-			}
+		// the clockwise quad around the edge q1, q3 that pt is on:
+		twin := t.Halfedges[onEdge]
+		otherTriI := twin - twin%3
+		quad := [4]int{
+			t.Triangles[PrevHalfedge(onEdge)], t.Triangles[onEdge],
+			t.Triangles[PrevHalfedge(twin)], t.Triangles[twin]}
+		split := t.fixed[t.edgeOf[onEdge]/2]
+		// the winding of the split edge from q1 to q3:
+		w := t.winding[t.edgeOf[onEdge]/2]
+		if t.Edges[t.edgeOf[onEdge]] != quad[1] {
+			w = -w
 		}
-		// generate new tris and edges
-		// 0:
-		t.Triangles[parentTriIs[0]] = quad[0]
-		t.Triangles[parentTriIs[0]+1] = quad[1]
-		t.Triangles[parentTriIs[0]+2] = ptI
-		// 1:
-		t.Triangles[parentTriIs[1]] = quad[1]
-		t.Triangles[parentTriIs[1]+1] = quad[2]
-		t.Triangles[parentTriIs[1]+2] = ptI
-		// our edge sortedness is guaranteed here because ptI is the
-		// largest index
-		t.Edges[oldEdgeI] = quad[1]
-		t.Edges[oldEdgeI+1] = ptI
-
-		t.Triangles[t.TriangleI+0] = quad[2]
-		t.Triangles[t.TriangleI+1] = quad[3]
-		t.Triangles[t.TriangleI+2] = ptI
-		t.Triangles[t.TriangleI+3] = quad[3]
-		t.Triangles[t.TriangleI+4] = quad[0]
-		t.Triangles[t.TriangleI+5] = ptI
-		t.Edges[t.EdgeI+0] = quad[2]
-		t.Edges[t.EdgeI+1] = ptI
-		t.Edges[t.EdgeI+2] = quad[3]
-		t.Edges[t.EdgeI+3] = ptI
-		t.Edges[t.EdgeI+4] = quad[0]
-		t.Edges[t.EdgeI+5] = ptI
-		fixedI := t.EdgeI >> 1
-		t.fixed[fixedI+0] = false
-		t.fixed[fixedI+1] = false
-		t.fixed[fixedI+2] = false
-		t.checkTris[t.checkTriI+0] = parentTriIs[0]
-		t.checkTris[t.checkTriI+1] = parentTriIs[1]
-		t.checkTris[t.checkTriI+2] = t.TriangleI
-		t.checkTris[t.checkTriI+3] = t.TriangleI + 3
-		t.TriangleI += 6
-		t.EdgeI += 6
-		t.checkTriI += 4
+		t.replaceTriangles(
+			[]int{triI, otherTriI, newTriI, newTriI + 3},
+			[]int{
+				quad[0], quad[1], ptI,
+				quad[1], quad[2], ptI,
+				quad[2], quad[3], ptI,
+				quad[3], quad[0], ptI})
+		if split {
+			// both halves of a constrained edge stay constrained:
+			t.constrain(t.edgeOf[triI+1], quad[1], w)
+			t.constrain(t.edgeOf[newTriI+1], ptI, w)
+		}
+		t.checkTris = append(t.checkTris[:0], triI, otherTriI, newTriI, newTriI+3)
 	} else {
 		// split 1 tri => 3 tris
-		triI := parentTriIs[0]
 		triVs := [3]int{
 			t.Triangles[triI], t.Triangles[triI+1], t.Triangles[triI+2]}
-		t.Triangles[triI] = triVs[0]
-		t.Triangles[triI+1] = triVs[1]
-		t.Triangles[triI+2] = ptI
-
-		t.Triangles[t.TriangleI+0] = triVs[1]
-		t.Triangles[t.TriangleI+1] = triVs[2]
-		t.Triangles[t.TriangleI+2] = ptI
-		t.Triangles[t.TriangleI+3] = triVs[2]
-		t.Triangles[t.TriangleI+4] = triVs[0]
-		t.Triangles[t.TriangleI+5] = ptI
-		t.Edges[t.EdgeI+0] = triVs[1]
-		t.Edges[t.EdgeI+1] = ptI
-		t.Edges[t.EdgeI+2] = triVs[2]
-		t.Edges[t.EdgeI+3] = ptI
-		t.Edges[t.EdgeI+4] = triVs[0]
-		t.Edges[t.EdgeI+5] = ptI
-		fixedI := t.EdgeI >> 1
-		t.fixed[fixedI+0] = false
-		t.fixed[fixedI+1] = false
-		t.fixed[fixedI+2] = false
-		t.checkTris[t.checkTriI+0] = triI
-		t.checkTris[t.checkTriI+1] = t.TriangleI
-		t.checkTris[t.checkTriI+2] = t.TriangleI + 3
-		t.TriangleI += 6
-		t.EdgeI += 6
-		t.checkTriI += 3
-	}
-	for t.checkTriI > 0 {
-		triI := t.checkTris[0]
-		triV := [3]int{
-			t.Triangles[triI], t.Triangles[triI+1], t.Triangles[triI+2]}
+		t.replaceTriangles(
+			[]int{triI, newTriI, newTriI + 3},
+			[]int{
+				triVs[0], triVs[1], ptI,
+				triVs[1], triVs[2], ptI,
+				triVs[2], triVs[0], ptI})
+		t.checkTris = append(t.checkTris[:0], triI, newTriI, newTriI+3)
+	}
+	t.flip()
+	return ptI, nil
+}
+
+// flip restores the Delaunay property around the triangles in checkTris, by
+// flipping the edges of each that aren't constrained and aren't Delaunay, and
+// then checking the triangles made by the flip.
+func (t *Triangulation) flip() {
+	for len(t.checkTris) > 0 {
+		triI := t.checkTris[len(t.checkTris)-1]
+		t.checkTris = t.checkTris[:len(t.checkTris)-1]
 		// for all edges
-		for i := 0; i < 3; i++ {
-			edge := [2]int{triV[(i+1)%3], triV[i]}
-			sortedEdge := [2]int{edge[0], edge[1]}
-			if edge[0] > edge[1] {
-				sortedEdge = [2]int{edge[1], edge[0]}
-			}
-			// find common edge index:
-			edgeI := 0
-			for ; edgeI < t.EdgeI; edgeI += 2 {
-				if t.Edges[edgeI] == sortedEdge[0] &&
-					t.Edges[edgeI+1] == sortedEdge[1] {
-					break
-				}
-			}
-			// if the edge is locked, give up now (at this step, this only
-			// applies to the initial boundary edges)
-			if t.fixed[edgeI/2] {
+		for e := triI; e < triI+3; e++ {
+			// constrained edges are never flipped:
+			if t.fixed[t.edgeOf[e]/2] {
 				continue
 			}
 			// find the triangle on the other side
-			found := false
-			otherTriI := -1
-			for n := 0; n < t.TriangleI; n += 3 {
-				if n == triI {
-					continue
-				}
-				if t.Triangles[n] == edge[0] && t.Triangles[n+1] == edge[1] {
-					found = true
-					otherTriI = n
-					break
-				}
-				if t.Triangles[n+1] == edge[0] && t.Triangles[n+2] == edge[1] {
-					found = true
-					otherTriI = n
-					break
-				}
-				if t.Triangles[n+2] == edge[0] && t.Triangles[n] == edge[1] {
-					found = true
-					otherTriI = n
-					break
-				}
-			}
+			twin := t.Halfedges[e]
 			// no neighbor?
-			if !found {
+			if twin < 0 {
 				continue
 			}
-			// circumcircle test:
-			quad := t.getSharedQuad(triI, otherTriI)
-			a := t.Verts[quad[0]]
-			b := t.Verts[quad[1]]
-			c := t.Verts[quad[2]]
-			d := t.Verts[quad[3]]
-			sign := (mgl32.Mat4{
-				d[0], d[1], d[0]*d[0] + d[1]*d[1], 1,
-				c[0], c[1], c[0]*c[0] + c[1]*c[1], 1,
-				b[0], b[1], b[0]*b[0] + b[1]*b[1], 1,
-				a[0], a[1], a[0]*a[0] + a[1]*a[1], 1,
-			}).Det()
-			// if the determinant is too close to 0, we'll get stuck in a cycle
-			if sign > 1e-7 {
+			otherTriI := twin - twin%3
+			// the clockwise quad around the edge q1, q3:
+			quad := [4]int{
+				t.Triangles[PrevHalfedge(e)], t.Triangles[e],
+				t.Triangles[PrevHalfedge(twin)], t.Triangles[twin]}
+			if inCircle(t.Verts[quad[0]], t.Verts[quad[1]], t.Verts[quad[3]],
+				t.Verts[quad[2]]) {
 				// flip: BD => AC
-				t.Triangles[triI] = quad[0]
-				t.Triangles[triI+1] = quad[1]
-				t.Triangles[triI+2] = quad[2]
-				t.Triangles[otherTriI] = quad[0]
-				t.Triangles[otherTriI+1] = quad[2]
-				t.Triangles[otherTriI+2] = quad[3]
-				newEdge := [2]int{quad[0], quad[2]}
-				if newEdge[0] > newEdge[1] {
-					newEdge = [2]int{quad[2], quad[0]}
-				}
-				t.Edges[edgeI] = newEdge[0]
-				t.Edges[edgeI+1] = newEdge[1]
-				t.checkTris[t.checkTriI+0] = triI
-				t.checkTris[t.checkTriI+1] = otherTriI
-				t.checkTriI += 2
+				t.replaceTriangles(
+					[]int{triI, otherTriI},
+					[]int{
+						quad[0], quad[1], quad[2],
+						quad[0], quad[2], quad[3]})
+				t.checkTris = append(t.checkTris, triI, otherTriI)
 				break
 			}
 		}
-		// remove the checked triangle:
-		t.checkTris[0] = t.checkTris[t.checkTriI-1]
-		t.checkTriI--
 	}
-	return ptI
 }
 
-// AddEdge forces an edge to exist in the triangulation.  This edge is then
-// guaranteed to exist in the triangulation, unless a successive call to AddEdge
-// specifies an edge that intersects this one.  If an intersecting edge is later
-// specified, the later edge will "win".
-func (t *Triangulation) AddEdge(indexA, indexB int) {
+// AddEdge forces an edge to exist in the triangulation, and constrains it so
+// that later calls to AddPoint don't remove it.  An edge that passes through
+// other vertices is added as the edges between them.  What happens when the
+// edge crosses a constrained edge depends on t.Policy.  AddEdge returns
+// ErrDegenerateGraph if the edge can't be inserted, such as when indexA and
+// indexB are equal.
+func (t *Triangulation) AddEdge(indexA, indexB int) error {
+	return t.addEdge(indexA, indexB, 1)
+}
+
+// addEdge is AddEdge, adding winding to the winding of the edges from indexA
+// to indexB.
+func (t *Triangulation) addEdge(indexA, indexB, winding int) error {
 	if indexA == indexB {
-		panic("bad graph")
+		return ErrDegenerateGraph
 	}
 	edge := [2]int{indexA, indexB}
 	if edge[0] > edge[1] {
 		edge = [2]int{indexB, indexA}
+		winding = -winding
 	}
-	edgeExists := false
-	for i := 0; i < t.EdgeI; i += 2 {
-		if t.Edges[i] == edge[0] && t.Edges[i+1] == edge[1] {
-			edgeExists = true
-			t.fixed[i/2] = true
-			break
-		}
+	if edgeI := t.findEdge(edge[0], edge[1]); edgeI >= 0 {
+		t.constrain(edgeI, edge[0], winding)
+		return nil
 	}
-	if edgeExists {
-		return
+	ptA := t.Verts[edge[0]]
+	ptB := t.Verts[edge[1]]
+	for _, e := range t.HalfedgesAround(edge[0]) {
+		b := t.Triangles[NextHalfedge(e)]
+		ptC := t.Verts[b]
+		if orient(ptA, ptB, ptC) == 0 && ptC.Sub(ptA).Dot(ptB.Sub(ptA)) > 0 {
+			// the edge runs along an existing edge to b, and then on from b:
+			t.constrain(t.edgeOf[e], edge[0], winding)
+			return t.addEdge(b, edge[1], winding)
+		}
 	}
+	// crossed is the half-edge of the triangle crossedTri, from
+	// crossedTri[1] to crossedTri[2], that the edge passes through:
 	crossedTri := [3]int{}
-	crossedTriI := -1
-	for i := 0; i < t.TriangleI; i += 3 {
-		if t.Triangles[i] == edge[0] {
-			if pointInAngle(t.Verts[edge[1]],
-				t.Verts[t.Triangles[i]],
-				t.Verts[t.Triangles[i+1]],
-				t.Verts[t.Triangles[i+2]]) {
-				crossedTri = [3]int{t.Triangles[i],
-					t.Triangles[i+1],
-					t.Triangles[i+2]}
-				crossedTriI = i
-				break
-			}
-		}
-		if t.Triangles[i+1] == edge[0] {
-			if pointInAngle(t.Verts[edge[1]],
-				t.Verts[t.Triangles[i+1]],
-				t.Verts[t.Triangles[i+2]],
-				t.Verts[t.Triangles[i]]) {
-				crossedTri = [3]int{t.Triangles[i+1],
-					t.Triangles[i+2],
-					t.Triangles[i]}
-				crossedTriI = i
-				break
-			}
-		}
-		if t.Triangles[i+2] == edge[0] {
-			if pointInAngle(t.Verts[edge[1]],
-				t.Verts[t.Triangles[i+2]],
-				t.Verts[t.Triangles[i]],
-				t.Verts[t.Triangles[i+1]]) {
-				crossedTri = [3]int{t.Triangles[i+2],
-					t.Triangles[i],
-					t.Triangles[i+1]}
-				crossedTriI = i
-				break
-			}
+	crossed := -1
+	for _, e := range t.HalfedgesAround(edge[0]) {
+		b := t.Triangles[NextHalfedge(e)]
+		c := t.Triangles[PrevHalfedge(e)]
+		// the edge leaves edge[0] between b and c:
+		if orient(ptA, t.Verts[b], ptB) < 0 && orient(ptA, t.Verts[c], ptB) > 0 {
+			crossedTri = [3]int{edge[0], b, c}
+			crossed = NextHalfedge(e)
+			break
 		}
 	}
-	ptA := t.Verts[edge[0]]
-	ptB := t.Verts[edge[1]]
+	if crossed == -1 {
+		return ErrDegenerateGraph
+	}
 	ptsU := []int{crossedTri[1]}
 	ptsL := []int{crossedTri[2]}
-	deadTriIs := []int{crossedTriI}
-	deadEdges := []int{}
-	t.newTriI = 0
-	t.newEdgeI = 0
-	ringEdges := []int{crossedTri[0], crossedTri[1], crossedTri[0], crossedTri[2]}
+	deadTriIs := []int{crossed - crossed%3}
+	// whether a constrained edge is removed:
+	removed := false
+	// the part of the edge beyond a vertex that it passes through:
+	rest := [2]int{-1, -1}
 	for {
 		// get opposite triangle:
-		otherTriI := -1
-		otherVertI := -1
-		for n := 0; n < t.TriangleI; n += 3 {
-			if n == crossedTriI {
-				continue
-			}
-			if t.Triangles[n] == crossedTri[2] && t.Triangles[n+1] == crossedTri[1] {
-				otherTriI = n
-				otherVertI = t.Triangles[n+2]
-				break
-			}
-			if t.Triangles[n+1] == crossedTri[2] && t.Triangles[n+2] == crossedTri[1] {
-				otherTriI = n
-				otherVertI = t.Triangles[n]
-				break
-			}
-			if t.Triangles[n+2] == crossedTri[2] && t.Triangles[n] == crossedTri[1] {
-				otherTriI = n
-				otherVertI = t.Triangles[n+1]
-				break
+		twin := t.Halfedges[crossed]
+		if twin < 0 {
+			return ErrDegenerateGraph
+		}
+		if t.fixed[t.edgeOf[crossed]/2] {
+			switch t.Policy {
+			case ConstraintError:
+				return ErrIntersectingEdges
+			case ConstraintSplit:
+				return t.splitEdges(edge, crossed, winding)
 			}
+			removed = true
 		}
+		otherTriI := twin - twin%3
+		otherVertI := t.Triangles[PrevHalfedge(twin)]
 		deadTriIs = append(deadTriIs, otherTriI)
-		deadEdges = append(deadEdges, crossedTri[1], crossedTri[2])
 		if len(deadTriIs) > 1e5 {
 			// in this case, we've either managed to loop around a small set of
 			// triangles (bad graph), or the edge is actually crossing 10k tris
-			panic("probable infinite loop detected")
+			return ErrNonTermination
 		}
 		if otherVertI == edge[1] {
-			ringEdges = append(ringEdges, crossedTri[1], otherVertI, crossedTri[2], otherVertI)
 			break
 		}
-		oppositePt := t.Verts[otherVertI]
-		ptSide := (ptB[0]-ptA[0])*(oppositePt[1]-ptA[1]) -
-			(ptB[1]-ptA[1])*(oppositePt[0]-ptA[0])
-		if ptSide > 1e-12 { // above
+		ptSide := orient(ptA, ptB, t.Verts[otherVertI])
+		if ptSide > 0 { // above
 			ptsU = append(ptsU, otherVertI)
-			ringEdges = append(ringEdges, crossedTri[1], otherVertI)
 			crossedTri = [3]int{crossedTri[1], otherVertI, crossedTri[2]}
-			crossedTriI = otherTriI
-		} else if ptSide < -1e-12 { // below
+			// the edge leaves through otherVertI, crossedTri[2]:
+			crossed = PrevHalfedge(twin)
+		} else if ptSide < 0 { // below
 			ptsL = append(ptsL, otherVertI)
-			ringEdges = append(ringEdges, crossedTri[2], otherVertI)
 			crossedTri = [3]int{crossedTri[2], crossedTri[1], otherVertI}
-			crossedTriI = otherTriI
+			// the edge leaves through crossedTri[1], otherVertI:
+			crossed = NextHalfedge(twin)
 		} else { // incident
-			t.AddEdge(otherVertI, edge[1])
+			// the rest of the edge is added once this part is done, since
+			// adding it may change the triangles crossed so far:
+			rest = [2]int{otherVertI, edge[1]}
 			edge[1] = otherVertI
 			break
 		}
 	}
-	t.retriangulate(ringEdges, ptsU, edge)
-	edge = [2]int{edge[1], edge[0]}
-	t.retriangulate(ringEdges, ptsL, edge)
-	if edge[0] > edge[1] {
-		edge = [2]int{edge[1], edge[0]}
-	}
-	t.newEdgeI -= 2
-	for i := 0; i < len(deadTriIs); i++ {
-		t.Triangles[deadTriIs[i]] = t.newTris[3*i]
-		t.Triangles[deadTriIs[i]+1] = t.newTris[3*i+1]
-		t.Triangles[deadTriIs[i]+2] = t.newTris[3*i+2]
-	}
-	for i := 0; i < len(deadEdges); i += 2 {
-		deadEdge := []int{deadEdges[i], deadEdges[i+1]}
-		if deadEdges[i] > deadEdges[i+1] {
-			deadEdge = []int{deadEdges[i+1], deadEdges[i]}
-		}
-		newEdge := [2]int{t.newEdges[i], t.newEdges[i+1]}
-		if t.newEdges[i] > t.newEdges[i+1] {
-			newEdge = [2]int{t.newEdges[i+1], t.newEdges[i]}
-		}
-		last := i == len(deadEdges)-2
-		for j := 0; j < t.EdgeI; j += 2 {
-			if deadEdge[0] == t.Edges[j] && deadEdge[1] == t.Edges[j+1] {
-				t.Edges[j] = newEdge[0]
-				t.Edges[j+1] = newEdge[1]
-				if last {
-					t.fixed[j/2] = true
-				}
-				break
-			}
-		}
+	t.newTriI = 0
+	t.retriangulate(ptsU, edge)
+	// the lower chain runs from edge[1] to edge[0] when seen from its side:
+	for i, j := 0, len(ptsL)-1; i < j; i, j = i+1, j-1 {
+		ptsL[i], ptsL[j] = ptsL[j], ptsL[i]
+	}
+	t.retriangulate(ptsL, [2]int{edge[1], edge[0]})
+	t.replaceTriangles(deadTriIs, t.newTris[:t.newTriI])
+	if edgeI := t.findEdge(edge[0], edge[1]); edgeI >= 0 {
+		t.constrain(edgeI, edge[0], winding)
 	}
+	if removed {
+		// the triangles around the removed edge were only Delaunay because
+		// of it:
+		t.checkTris = append(t.checkTris[:0], deadTriIs...)
+		t.flip()
+	}
+	if rest[0] >= 0 {
+		return t.addEdge(rest[0], rest[1], winding)
+	}
+	return nil
 }
 
-func (t *Triangulation) retriangulate(ringEdges, vertIs []int, edgeIs [2]int) {
-	cI := -1
-	if len(vertIs) > 1 {
-		cI = vertIs[0]
-		c := t.Verts[cI]
-		// maintaining sanity about geometric orientation here is
-		// a bit tricky
-		a := t.Verts[edgeIs[0]]
-		b := t.Verts[edgeIs[1]]
-		// find the closest vert to the edge:
-		for i := 1; i < len(vertIs); i++ {
-			d := t.Verts[vertIs[i]]
-			sign := (mgl32.Mat4{
-				a[0], a[1], a[0]*a[0] + a[1]*a[1], 1,
-				b[0], b[1], b[0]*b[0] + b[1]*b[1], 1,
-				c[0], c[1], c[0]*c[0] + c[1]*c[1], 1,
-				d[0], d[1], d[0]*d[0] + d[1]*d[1], 1,
-			}).Det()
-			if sign > 0 {
-				cI = vertIs[i]
-				c = t.Verts[cI]
-			}
+// maxSplitDepth limits how deeply splitEdges recurses.  Where edges cross
+// between vertices only an ulp or so apart, the vertex added where they cross
+// can round to a place that leaves edges still crossing, every time.
+const maxSplitDepth = 64
+
+// splitEdges adds the edge from the vertex edge[0] to edge[1], with winding,
+// which crosses the constrained half-edge crossed, as two edges to a vertex
+// where they cross, and reroutes the crossed edge through the same vertex.
+func (t *Triangulation) splitEdges(edge [2]int, crossed, winding int) error {
+	if t.splitDepth >= maxSplitDepth {
+		return ErrNonTermination
+	}
+	t.splitDepth++
+	defer func() { t.splitDepth-- }()
+	c, d := t.Triangles[crossed], t.Triangles[NextHalfedge(crossed)]
+	a, b := t.Verts[edge[0]], t.Verts[edge[1]]
+	// the edges cross at a + s*(b - a), where:
+	s := orient(t.Verts[c], t.Verts[d], a) /
+		(orient(t.Verts[c], t.Verts[d], a) - orient(t.Verts[c], t.Verts[d], b))
+	p, err := t.AddPoint(
+		a[0]+s*(b[0]-a[0]),
+		a[1]+s*(b[1]-a[1]))
+	if err != nil {
+		return err
+	}
+	// p is only on cd if AddPoint split it; otherwise, rounding put p to one
+	// side, and cd has to bend through p too:
+	if e := t.Halfedge(c, d); e >= 0 && p != c && p != d {
+		edgeI := t.edgeOf[e]
+		w := t.winding[edgeI/2]
+		if t.Edges[edgeI] != c {
+			w = -w
 		}
-		// partition vertIs into left/right of c:
-		// left/right is determined by following the edge ring defined
-		// by vertIs split on c
-		leftVertIs := []int{}
-		rightVertIs := []int{}
-		{
-			ringI := edgeIs[0]
-			prevRingI := -1
-			right := false
-			ptInRing := func(idx int) (onRing bool, onEdge bool) {
-				for _, vI := range vertIs {
-					if vI == idx {
-						return true, false
-					}
-				}
-				if idx == edgeIs[1] || idx == edgeIs[0] {
-					return true, true
-				}
-				return false, false
-			}
-			for {
-				inRing := false
-				shouldBreak := false
-				testI := -1
-				for i := 0; i < len(ringEdges); i += 2 {
-					if ringEdges[i] == ringI {
-						testI = ringEdges[i+1]
-					}
-					if ringEdges[i+1] == ringI {
-						testI = ringEdges[i]
-					}
-					if testI >= 0 && prevRingI != testI {
-						inRing, shouldBreak = ptInRing(testI)
-						if shouldBreak {
-							break
-						}
-						if inRing {
-							prevRingI = ringI
-							ringI = testI
-							if ringI == cI {
-								right = true
-							} else if right {
-								rightVertIs = append(rightVertIs, ringI)
-							} else {
-								leftVertIs = append(leftVertIs, ringI)
-							}
-							break
-						}
-					}
-				}
-				if shouldBreak {
-					break
-				}
-				if ringI == prevRingI {
-					panic("finding edge in ring won't terminate")
-				}
-			}
+		t.fixed[edgeI/2] = false
+		t.winding[edgeI/2] = 0
+		twin := t.Halfedges[e]
+		t.checkTris = append(t.checkTris[:0], e-e%3, twin-twin%3)
+		t.flip()
+		if err := t.addEdge(c, p, w); err != nil {
+			return err
+		}
+		if err := t.addEdge(p, d, w); err != nil {
+			return err
 		}
-		t.retriangulate(ringEdges, leftVertIs, [2]int{edgeIs[0], cI})
-		t.retriangulate(ringEdges, rightVertIs, [2]int{cI, edgeIs[1]})
 	}
-	if len(vertIs) > 0 {
-		if cI == -1 {
-			cI = vertIs[0]
+	if edge[0] != p {
+		if err := t.addEdge(edge[0], p, winding); err != nil {
+			return err
 		}
-		t.newTris[t.newTriI+0] = edgeIs[1]
-		t.newTris[t.newTriI+1] = edgeIs[0]
-		t.newTris[t.newTriI+2] = cI
-		t.newEdges[t.newEdgeI+0] = edgeIs[0]
-		t.newEdges[t.newEdgeI+1] = edgeIs[1]
-		t.newTriI += 3
-		t.newEdgeI += 2
 	}
+	if p != edge[1] {
+		return t.addEdge(p, edge[1], winding)
+	}
+	return nil
 }
 
-// getSharedQuad returns the quad a,b,c,d defined by triangles a,b,c and c,b,d;
-// the returned quad array has the verts of the shared edge at quad[1] and
-// quad[3].
-func (t *Triangulation) getSharedQuad(triA, triB int) [4]int {
-	quad := [4]int{}
-	tris := [2]int{triA, triB}
-	for n := 0; n < 2; n++ {
-		triA = tris[n]
-		triB = tris[1-n]
-		for j := 0; j < 3; j++ {
-			m := t.Triangles[triA+j]
-			found := false
-			for i := 0; i < 3; i++ {
-				if t.Triangles[triB+i] == m {
-					found = true
-					break
-				}
-			}
-			if !found {
-				quad[n*2] = m
-				quad[n*2+1] = t.Triangles[triA+((j+1)%3)]
-				break
-			}
+// retriangulate appends to newTris the Delaunay triangulation of the polygon
+// made by the edge edgeIs and the chain of vertices vertIs to its left, from
+// edgeIs[0] to edgeIs[1].  The triangle on the edge takes the vertex of the
+// chain whose circumcircle with the edge contains no other vertex of the chain,
+// splitting the rest of the chain in two.
+func (t *Triangulation) retriangulate(vertIs []int, edgeIs [2]int) {
+	if len(vertIs) == 0 {
+		return
+	}
+	a := t.Verts[edgeIs[0]]
+	b := t.Verts[edgeIs[1]]
+	c := 0
+	for i := 1; i < len(vertIs); i++ {
+		if inCircle(b, a, t.Verts[vertIs[c]], t.Verts[vertIs[i]]) {
+			c = i
 		}
 	}
-	return quad
-}
-
-// getBarycentric returns the two barycentric components of the triangle abc for
-// p relative to b and c
-func getBarycentric(p, a, b, c mgl32.Vec2) (float32, float32) {
-	v0 := c.Sub(a)
-	v1 := b.Sub(a)
-	v2 := p.Sub(a)
-	dot00 := v0.Dot(v0)
-	dot01 := v0.Dot(v1)
-	dot02 := v0.Dot(v2)
-	dot11 := v1.Dot(v1)
-	dot12 := v1.Dot(v2)
-	norm := (dot00*dot11 - dot01*dot01)
-	u := (dot11*dot02 - dot01*dot12) / norm
-	v := (dot00*dot12 - dot01*dot02) / norm
-	return u, v
-}
-
-// pointInTriangle returns true if p is inside the triangle abc
-func pointInTriangle(p, a, b, c mgl32.Vec2) bool {
-	u, v := getBarycentric(p, a, b, c)
-	// todo: math around rounding error better
-	return u >= -4e-6 && v >= -4e-6 && u+v < 1.0000076
-}
-
-// pointInAngle returns true if p is inside the angle defined by lines ab and ac
-func pointInAngle(p, a, b, c mgl32.Vec2) bool {
-	u, v := getBarycentric(p, a, b, c)
-	return u >= -4e-6 && v >= -4e-6
-}
-
-type indexedFloatSorter struct {
-	fs []float32
-	is []int
-	l  int
-}
-
-func (s *indexedFloatSorter) Len() int {
-	return s.l
-}
-
-func (s *indexedFloatSorter) Less(i, j int) bool {
-	return s.fs[i] < s.fs[j]
-}
-
-func (s *indexedFloatSorter) Swap(i, j int) {
-	idx := s.is[i]
-	s.is[i] = s.is[j]
-	s.is[j] = idx
-	f := s.fs[i]
-	s.fs[i] = s.fs[j]
-	s.fs[j] = f
+	cI := vertIs[c]
+	t.retriangulate(vertIs[:c], [2]int{edgeIs[0], cI})
+	t.retriangulate(vertIs[c+1:], [2]int{cI, edgeIs[1]})
+	t.newTris[t.newTriI+0] = edgeIs[1]
+	t.newTris[t.newTriI+1] = edgeIs[0]
+	t.newTris[t.newTriI+2] = cI
+	t.newTriI += 3
 }
@@ -0,0 +1,789 @@
+package cdt
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// randomPoints returns n points spread uniformly over the unit square.
+func randomPoints(n int) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	points := make([]float64, 2*n)
+	for i := range points {
+		points[i] = rng.Float64()
+	}
+	return points
+}
+
+// ringPoints returns n points around a wobbly circle centred in the unit
+// square, along with the edges joining them in to a closed outline.
+func ringPoints(n int) ([]float32, []int32) {
+	points := make([]float32, 0, 2*n)
+	edges := make([]int32, 0, 2*n)
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		r := 0.4 + 0.05*math.Sin(7*a)
+		points = append(points, float32(0.5+r*math.Cos(a)), float32(0.5+r*math.Sin(a)))
+		edges = append(edges, int32(i), int32((i+1)%n))
+	}
+	return points, edges
+}
+
+// checkDelaunay fails the test unless every triangle of t is clockwise and no
+// vertex lies inside the circumcircle of a triangle.
+func checkDelaunay(tb testing.TB, t *Triangulation) {
+	for i := 0; i < t.TriangleI; i += 3 {
+		a := t.Verts[t.Triangles[i]]
+		b := t.Verts[t.Triangles[i+1]]
+		c := t.Verts[t.Triangles[i+2]]
+		if cross := b.Sub(a)[0]*c.Sub(a)[1] - b.Sub(a)[1]*c.Sub(a)[0]; cross >= 0 {
+			tb.Fatalf("triangle %d %v isn't clockwise", i/3, t.Triangles[i:i+3])
+		}
+		for j := 4; j < t.VertI; j++ {
+			if inCircumcircle(a, b, c, t.Verts[j]) {
+				tb.Fatalf("vertex %d is inside the circumcircle of triangle %d %v",
+					j, i/3, t.Triangles[i:i+3])
+			}
+		}
+	}
+}
+
+// inCircumcircle reports whether d is clearly inside the circumcircle of the
+// clockwise triangle abc, allowing for cocircular points.
+func inCircumcircle(a, b, c, d mgl64.Vec2) bool {
+	adx, ady := a[0]-d[0], a[1]-d[1]
+	bdx, bdy := b[0]-d[0], b[1]-d[1]
+	cdx, cdy := c[0]-d[0], c[1]-d[1]
+	alift, blift, clift := adx*adx+ady*ady, bdx*bdx+bdy*bdy, cdx*cdx+cdy*cdy
+	det := alift*(bdx*cdy-cdx*bdy) - blift*(adx*cdy-cdx*ady) + clift*(adx*bdy-bdx*ady)
+	scale := alift*math.Abs(bdx*cdy-cdx*bdy) + blift*math.Abs(adx*cdy-cdx*ady) +
+		clift*math.Abs(adx*bdy-bdx*ady)
+	return det < -1e-9*scale
+}
+
+// checkHalfedges fails the test unless Halfedges links each half-edge of t to
+// its opposite, and the boundary of t is the bounding rectangle.
+func checkHalfedges(tb testing.TB, t *Triangulation) {
+	boundary := 0
+	for e := 0; e < t.TriangleI; e++ {
+		a, b := t.Triangles[e], t.Triangles[NextHalfedge(e)]
+		twin := t.Halfedges[e]
+		if twin < 0 {
+			if a >= 4 || b >= 4 {
+				tb.Fatalf("half-edge %d from %d to %d is on the boundary", e, a, b)
+			}
+			boundary++
+			continue
+		}
+		if t.Halfedges[twin] != e || t.Triangles[twin] != b || t.Triangles[NextHalfedge(twin)] != a {
+			tb.Fatalf("half-edge %d from %d to %d has twin %d", e, a, b, twin)
+		}
+		if got := t.Halfedge(a, b); got != e {
+			tb.Fatalf("Halfedge(%d, %d) = %d, want %d", a, b, got, e)
+		}
+	}
+	if boundary != 4 {
+		tb.Fatalf("%d half-edges on the boundary, want 4", boundary)
+	}
+}
+
+func TestAddPoint(t *testing.T) {
+	const n = 300
+	points := randomPoints(n)
+	tri := NewTriangulation(-1, 2, -1, 2, n)
+	for i := 0; i < n; i++ {
+		idx, err := tri.AddPoint(points[2*i], points[2*i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := tri.Verts[idx]; v[0] != points[2*i] || v[1] != points[2*i+1] {
+			t.Fatalf("point %d was added as %v", i, v)
+		}
+	}
+	if got, want := tri.TriangleI/3, 2*tri.VertI-6; got != want {
+		t.Errorf("%d triangles for %d vertices, want %d", got, tri.VertI, want)
+	}
+	checkDelaunay(t, tri)
+	checkHalfedges(t, tri)
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < tri.VertI; i++ {
+		for _, triI := range tri.TrianglesAround(i) {
+			if tri.Triangles[triI] != i && tri.Triangles[triI+1] != i && tri.Triangles[triI+2] != i {
+				t.Fatalf("TrianglesAround(%d) includes triangle %d %v", i, triI/3,
+					tri.Triangles[triI:triI+3])
+			}
+		}
+	}
+	for i := 0; i < tri.TriangleI; i += 3 {
+		a := tri.Verts[tri.Triangles[i]]
+		b := tri.Verts[tri.Triangles[i+1]]
+		c := tri.Verts[tri.Triangles[i+2]]
+		centroid := a.Add(b).Add(c).Mul(1.0 / 3)
+		if got := tri.Locate(centroid[0], centroid[1]); got != i {
+			t.Fatalf("Locate(%v) = %d, want %d", centroid, got, i)
+		}
+	}
+
+	// adding a point again returns the existing vertex:
+	if idx, err := tri.AddPoint(points[10], points[11]); err != nil || idx != 9 {
+		t.Errorf("re-adding point 5 returned %d, %v", idx, err)
+	}
+	if _, err := tri.AddPoint(3, 0); err != ErrOutOfBounds {
+		t.Errorf("adding an out-of-bounds point returned %v", err)
+	}
+}
+
+func TestAddEdge(t *testing.T) {
+	const n = 300
+	points, edges := ringPoints(n)
+	tri := NewTriangulation(-1, 2, -1, 2, n)
+	is := make([]int, n)
+	for _, j := range rand.New(rand.NewSource(1)).Perm(n) {
+		var err error
+		if is[j], err = tri.AddPoint(float64(points[2*j]), float64(points[2*j+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a chord across the ring crosses many triangles:
+	if err := tri.AddEdge(is[0], is[n/2]); err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < len(edges); j += 2 {
+		if err := tri.AddEdge(is[edges[j]], is[edges[j+1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkHalfedges(t, tri)
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+	if got, want := tri.TriangleI/3, 2*tri.VertI-6; got != want {
+		t.Errorf("%d triangles for %d vertices, want %d", got, tri.VertI, want)
+	}
+	for j := 0; j < len(edges); j += 2 {
+		a, b := is[edges[j]], is[edges[j+1]]
+		if tri.Halfedge(a, b) < 0 && tri.Halfedge(b, a) < 0 {
+			t.Errorf("edge %d, %d is missing", a, b)
+		}
+	}
+	if tri.Halfedge(is[0], is[n/2]) < 0 && tri.Halfedge(is[n/2], is[0]) < 0 {
+		t.Errorf("edge %d, %d is missing", is[0], is[n/2])
+	}
+}
+
+// stripPoints returns a triangulation of two rows of k points zigzagging
+// along a strip, with a vertex at either end, which it also returns.  An edge
+// between the ends crosses every triangle in the strip.
+func stripPoints(tb testing.TB, k int) (tri *Triangulation, a, b int) {
+	tri = NewTriangulation(-1, float64(k+2), -1, 2, 2*k+2)
+	for i := 0; i < k; i++ {
+		if _, err := tri.AddPoint(float64(i)+0.5, 0); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := tri.AddPoint(float64(i), 1); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	var err error
+	if a, err = tri.AddPoint(-0.5, 0.5); err != nil {
+		tb.Fatal(err)
+	}
+	if b, err = tri.AddPoint(float64(k)+0.5, 0.5); err != nil {
+		tb.Fatal(err)
+	}
+	return tri, a, b
+}
+
+func TestAddLongEdge(t *testing.T) {
+	tri, a, b := stripPoints(t, 2000)
+	if err := tri.AddEdge(a, b); err != nil {
+		t.Fatal(err)
+	}
+	checkHalfedges(t, tri)
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+	if tri.Halfedge(a, b) < 0 && tri.Halfedge(b, a) < 0 {
+		t.Errorf("edge %d, %d is missing", a, b)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	newTri := func() *Triangulation {
+		const n = 50
+		points, edges := ringPoints(n)
+		tri := NewTriangulation(-1, 2, -1, 2, n)
+		for i := 0; i < n; i++ {
+			if _, err := tri.AddPoint(float64(points[2*i]), float64(points[2*i+1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < len(edges); i += 2 {
+			if err := tri.AddEdge(int(edges[i])+4, int(edges[i+1])+4); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tri.AddEdge(4, 4+n/2); err != nil {
+			t.Fatal(err)
+		}
+		return tri
+	}
+	if err := newTri().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name    string
+		corrupt func(tri *Triangulation)
+	}{
+		{"counter-clockwise triangle", func(tri *Triangulation) {
+			tri.Triangles[0], tri.Triangles[1] = tri.Triangles[1], tri.Triangles[0]
+		}},
+		{"unsorted edge", func(tri *Triangulation) {
+			tri.Edges[0], tri.Edges[1] = tri.Edges[1], tri.Edges[0]
+		}},
+		{"missing edge", func(tri *Triangulation) {
+			tri.EdgeI -= 2
+		}},
+		{"bad twin", func(tri *Triangulation) {
+			for e := range tri.Halfedges[:tri.TriangleI] {
+				if tri.Halfedges[e] >= 0 {
+					tri.Halfedges[e] = -1
+					return
+				}
+			}
+		}},
+		{"non-Delaunay edge", func(tri *Triangulation) {
+			// the chord is only there because it's fixed:
+			tri.fixed[tri.edgeOf[tri.Halfedge(4, 4+25)]/2] = false
+		}},
+	} {
+		tri := newTri()
+		c.corrupt(tri)
+		if err := tri.Validate(); err == nil {
+			t.Errorf("%s: Validate returned nil", c.name)
+		} else {
+			t.Logf("%s: %v", c.name, err)
+		}
+	}
+}
+
+func TestConstraintPolicy(t *testing.T) {
+	// two constrained edges crossing at (0.5, 0.5), among random points:
+	newTri := func(policy ConstraintPolicy) (*Triangulation, [4]int) {
+		const n = 100
+		points := append(randomPoints(n), 0.1, 0.5, 0.9, 0.5, 0.5, 0.1, 0.5, 0.9)
+		// sized for exactly the points, so ConstraintSplit has to grow it:
+		tri := NewTriangulation(-1, 2, -1, 2, n+4)
+		tri.Policy = policy
+		is := [4]int{}
+		for i := 0; i < n+4; i++ {
+			idx, err := tri.AddPoint(points[2*i], points[2*i+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i >= n {
+				is[i-n] = idx
+			}
+		}
+		if err := tri.AddEdge(is[0], is[1]); err != nil {
+			t.Fatal(err)
+		}
+		return tri, is
+	}
+	constrained := func(tri *Triangulation, a, b int) bool {
+		edgeI := tri.findEdge(a, b)
+		return edgeI >= 0 && tri.IsConstrained(edgeI)
+	}
+
+	tri, is := newTri(ConstraintLastWins)
+	if err := tri.AddEdge(is[2], is[3]); err != nil {
+		t.Fatal(err)
+	}
+	if !constrained(tri, is[2], is[3]) || tri.findEdge(is[0], is[1]) >= 0 {
+		t.Errorf("ConstraintLastWins kept the first edge")
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	tri, is = newTri(ConstraintError)
+	if err := tri.AddEdge(is[2], is[3]); err != ErrIntersectingEdges {
+		t.Errorf("ConstraintError returned %v", err)
+	}
+	if !constrained(tri, is[0], is[1]) {
+		t.Errorf("ConstraintError removed the first edge")
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// the part of an edge up to a vertex it passes through before crossing
+	// stays added:
+	tri, is = newTri(ConstraintError)
+	var ms [3]int
+	for i, y := range []float64{0.1, 0.3, 0.9} {
+		var err error
+		if ms[i], err = tri.AddPoint(0.3, y); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tri.AddEdge(ms[0], ms[2]); err != ErrIntersectingEdges {
+		t.Errorf("ConstraintError returned %v for an edge through a vertex", err)
+	}
+	if !constrained(tri, ms[0], ms[1]) {
+		t.Errorf("ConstraintError dropped the part before the crossing")
+	}
+	if !constrained(tri, is[0], is[1]) {
+		t.Errorf("ConstraintError removed the first edge")
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	tri, is = newTri(ConstraintSplit)
+	vertI := tri.VertI
+	if err := tri.AddEdge(is[2], is[3]); err != nil {
+		t.Fatal(err)
+	}
+	if tri.VertI != vertI+1 || tri.Verts[vertI] != (mgl64.Vec2{0.5, 0.5}) {
+		t.Fatalf("ConstraintSplit added %d vertices", tri.VertI-vertI)
+	}
+	for _, v := range is {
+		if !constrained(tri, v, vertI) {
+			t.Errorf("edge %d, %d isn't constrained", v, vertI)
+		}
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// a point on a constrained edge splits it:
+	tri, is = newTri(ConstraintLastWins)
+	idx, err := tri.AddPoint(0.3, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !constrained(tri, is[0], idx) || !constrained(tri, idx, is[1]) {
+		t.Errorf("splitting a constrained edge lost the constraint")
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDegenerate(t *testing.T) {
+	// points rounded onto a line, and so nearly collinear, along with pairs
+	// of points an ulp apart, all joined in a chain:
+	const n = 200
+	points := []float32{}
+	for i := 0; i < n; i++ {
+		x := 0.1 + 0.8*float64(i)/n
+		points = append(points, float32(x), float32(0.1+x/3))
+	}
+	for i := 0; i < 20; i++ {
+		x := float32(0.2 + 0.03*float64(i))
+		points = append(points, x, 0.6, math.Nextafter32(x, 1), 0.6)
+	}
+	edges := []int32{}
+	for i := 0; i+1 < len(points)/2; i++ {
+		edges = append(edges, int32(i), int32(i+1))
+	}
+	tri := NewTriangulation(-1, 2, -1, 2, len(points)/2)
+	is := make([]int, len(points)/2)
+	for i := range is {
+		var err error
+		if is[i], err = tri.AddPoint(float64(points[2*i]), float64(points[2*i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tri.VertI != 4+len(is) {
+		t.Errorf("%d vertices for %d distinct points", tri.VertI-4, len(is))
+	}
+	for i := 0; i < len(edges); i += 2 {
+		if err := tri.AddEdge(is[edges[i]], is[edges[i+1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tri.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	verts, srcToDstIs, triangles, err := Triangulate(-1, 2, -1, 2, points, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTriangulation(-1, 2, -1, 2, points, edges,
+		verts, srcToDstIs, triangles); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTriangulate(t *testing.T) {
+	const n = 300
+	points, edges := ringPoints(n)
+	// a duplicate point:
+	points = append(points, points[0], points[1])
+	verts, srcToDstIs, triangles, err := Triangulate(-1, 2, -1, 2, points, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(verts), 2*(n+4); got != want {
+		t.Fatalf("%d vertex coordinates, want %d", got, want)
+	}
+	if got, want := verts[:8], []float32{-1, -1, -1, 2, 2, -1, 2, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("corners are %v, want %v", got, want)
+	}
+	for i, dstI := range srcToDstIs {
+		if verts[dstI] != points[2*i] || verts[dstI+1] != points[2*i+1] {
+			t.Fatalf("point %d maps to %v", i, verts[dstI:dstI+2])
+		}
+	}
+	if srcToDstIs[n] != srcToDstIs[0] {
+		t.Errorf("duplicate point maps to %d, want %d", srcToDstIs[n], srcToDstIs[0])
+	}
+	if got, want := len(triangles), 3*(2*(n+4)-6); got != want {
+		t.Fatalf("%d triangle indices, want %d", got, want)
+	}
+	// every edge must be the side of a triangle:
+	sides := map[[2]int32]bool{}
+	for i := 0; i < len(triangles); i += 3 {
+		for j := 0; j < 3; j++ {
+			sides[[2]int32{triangles[i+j], triangles[i+(j+1)%3]}] = true
+		}
+	}
+	for i := 0; i < len(edges); i += 2 {
+		a, b := srcToDstIs[edges[i]], srcToDstIs[edges[i+1]]
+		if !sides[[2]int32{a, b}] && !sides[[2]int32{b, a}] {
+			t.Errorf("edge %d, %d is missing", edges[i], edges[i+1])
+		}
+	}
+}
+
+func TestTriangulatePoints(t *testing.T) {
+	const n = 300
+	points, edges := ringPoints(n)
+	// far from the origin, where the padding must still be representable:
+	for i := range points {
+		points[i] += 1e4
+	}
+	verts, srcToDstIs, triangles, err := TriangulatePoints(points, edges, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, right, bottom, top := Bounds(points)
+	if err := checkTriangulation(left, right, bottom, top, points, edges,
+		verts, srcToDstIs, triangles); err != nil {
+		t.Fatal(err)
+	}
+
+	hull, hullIs, hullTris, err := TriangulatePoints(points, edges, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(hull), fmt.Sprint(verts[8:]); got != want {
+		t.Errorf("vertices without corners are %v, want %v", got, want)
+	}
+	for i, dstI := range hullIs {
+		if dstI != srcToDstIs[i]-8 {
+			t.Fatalf("point %d maps to %d without corners, want %d", i, dstI, srcToDstIs[i]-8)
+		}
+	}
+	checkHull(t, hull, hullTris)
+
+	// a corner inside the circumcircle of the thin triangle along the bottom
+	// of the hull mustn't flip the hull's side away:
+	points = []float32{0, 0, 2, 0, 1, 1, 1, 0.001}
+	hull, _, hullTris, err = TriangulatePoints(points, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHull(t, hull, hullTris)
+	if got := area(hull, hullTris); math.Abs(got-1) > 1e-6 {
+		t.Errorf("triangles without corners have area %v, want 1", got)
+	}
+
+	// a single point has no triangles without the corners:
+	if _, _, triangles, err := TriangulatePoints([]float32{3, 4}, nil, false); err != nil || len(triangles) != 0 {
+		t.Errorf("a single point has triangles %v, %v", triangles, err)
+	}
+}
+
+// checkHull fails the test unless triangles, as indices in to verts, cover
+// exactly the convex hull of verts: no vertex is outside a side of the
+// triangles, and there are as many as a triangulation of the hull has.
+func checkHull(tb testing.TB, verts []float32, triangles []int32) {
+	tb.Helper()
+	point := func(i int32) mgl64.Vec2 {
+		return mgl64.Vec2{float64(verts[i]), float64(verts[i+1])}
+	}
+	for _, i := range triangles {
+		if i < 0 || int(i) >= len(verts) {
+			tb.Fatalf("index %d out of range", i)
+		}
+	}
+	half := map[[2]int32]bool{}
+	for i := 0; i < len(triangles); i += 3 {
+		for j := 0; j < 3; j++ {
+			half[[2]int32{triangles[i+j], triangles[i+(j+1)%3]}] = true
+		}
+	}
+	sides := 0
+	for e := range half {
+		if half[[2]int32{e[1], e[0]}] {
+			continue
+		}
+		sides++
+		// the triangles are clockwise, so the outside is to the left:
+		for v := 0; v+1 < len(verts); v += 2 {
+			if orient(point(e[0]), point(e[1]), point(int32(v))) > 0 {
+				tb.Fatalf("vertex %d is outside the side %v", v, e)
+			}
+		}
+	}
+	// every vertex is on the hull or inside it, and Euler's formula gives the
+	// number of triangles of n vertices with h on the hull as 2n - 2 - h:
+	if got, want := len(triangles)/3, len(verts)-2-sides; got != want {
+		tb.Errorf("%d triangles for %d vertices with %d on the hull, want %d",
+			got, len(verts)/2, sides, want)
+	}
+}
+
+// squarePoints returns the corners of an axis-aligned square, counter-clockwise
+// from its bottom-left corner, and the edges around it.
+func squarePoints(x, y, size float32, first int32) ([]float32, []int32) {
+	points := []float32{x, y, x + size, y, x + size, y + size, x, y + size}
+	edges := []int32{first, first + 1, first + 1, first + 2, first + 2, first + 3, first + 3, first}
+	return points, edges
+}
+
+// area returns the total area of triangles.
+func area(verts []float32, triangles []int32) float64 {
+	var sum float64
+	for i := 0; i < len(triangles); i += 3 {
+		a := mgl64.Vec2{float64(verts[triangles[i]]), float64(verts[triangles[i]+1])}
+		b := mgl64.Vec2{float64(verts[triangles[i+1]]), float64(verts[triangles[i+1]+1])}
+		c := mgl64.Vec2{float64(verts[triangles[i+2]]), float64(verts[triangles[i+2]+1])}
+		sum += math.Abs(orient(a, b, c)) / 2
+	}
+	return sum
+}
+
+func TestTriangulateFill(t *testing.T) {
+	outer, outerEdges := squarePoints(0, 0, 10, 0)
+	inner, innerEdges := squarePoints(3, 3, 4, 4)
+	// the same square clockwise:
+	hole := []int32{4, 7, 7, 6, 6, 5, 5, 4}
+	for _, test := range []struct {
+		name     string
+		inner    []int32
+		rule     FillRule
+		interior float64
+	}{
+		{"nested", innerEdges, NonZero, 100},
+		{"nested", innerEdges, EvenOdd, 84},
+		{"hole", hole, NonZero, 84},
+		{"hole", hole, EvenOdd, 84},
+	} {
+		points := append(append([]float32{}, outer...), inner...)
+		edges := append(append([]int32{}, outerEdges...), test.inner...)
+		for _, corners := range []bool{false, true} {
+			verts, _, interior, exterior, err := TriangulateFill(points, edges, test.rule, corners)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := area(verts, interior); got != test.interior {
+				t.Errorf("%s, rule %d: interior has area %v, want %v",
+					test.name, test.rule, got, test.interior)
+			}
+			want := 100 - test.interior
+			if corners {
+				left, right, bottom, top := Bounds(points)
+				want = float64(right-left)*float64(top-bottom) - test.interior
+			}
+			if got := area(verts, exterior); math.Abs(got-want) > 1e-3 {
+				t.Errorf("%s, rule %d, corners %v: exterior has area %v, want %v",
+					test.name, test.rule, corners, got, want)
+			}
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	// two overlapping squares, split where they cross:
+	a, aEdges := squarePoints(0, 0, 6, 0)
+	b, bEdges := squarePoints(4, 4, 6, 4)
+	points := append(a, b...)
+	edges := append(aEdges, bEdges...)
+	tri := NewTriangulation(-1, 11, -1, 11, len(points)/2)
+	tri.Policy = ConstraintSplit
+	added := make([]int, len(points)/2)
+	for i := range added {
+		var err error
+		if added[i], err = tri.AddPoint(float64(points[2*i]), float64(points[2*i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < len(edges); i += 2 {
+		if err := tri.AddEdge(added[edges[i]], added[edges[i+1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tri.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	verts := make([]float32, 2*tri.VertI)
+	for v := 0; v < tri.VertI; v++ {
+		verts[2*v], verts[2*v+1] = float32(tri.Verts[v][0]), float32(tri.Verts[v][1])
+	}
+	triangles := func(triIs []int) []int32 {
+		result := []int32{}
+		for _, triI := range triIs {
+			for _, v := range tri.Triangles[triI : triI+3] {
+				result = append(result, int32(2*v))
+			}
+		}
+		return result
+	}
+	for _, test := range []struct {
+		rule     FillRule
+		interior float64
+	}{
+		{NonZero, 68},
+		{EvenOdd, 64},
+	} {
+		interior, exterior := tri.Classify(test.rule)
+		if got := area(verts, triangles(interior)); got != test.interior {
+			t.Errorf("rule %d: interior has area %v, want %v", test.rule, got, test.interior)
+		}
+		if got, want := area(verts, triangles(exterior)), 144-test.interior; got != want {
+			t.Errorf("rule %d: exterior has area %v, want %v", test.rule, got, want)
+		}
+	}
+}
+
+func TestTriangulateFixed(t *testing.T) {
+	// font units around a circle, too large for float32 to tell apart:
+	const n = 200
+	points := []int32{}
+	edges := []int32{}
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / n
+		points = append(points,
+			int32(1<<26+(1<<25)*math.Cos(a)), int32(1<<26+(1<<25)*math.Sin(a)))
+		edges = append(edges, int32(i), int32((i+1)%n))
+	}
+	for i := int32(0); i < 10; i++ {
+		points = append(points, 1<<26+1000*i, 1<<26, 1<<26+1000*i+1, 1<<26+1)
+	}
+	// scaling by 1/1000, unlike a power of 2, rounds, and must only round
+	// once:
+	for _, scale := range []float64{0x1p-16, 1.0 / 1000} {
+		verts, srcToDstIs, triangles, err := TriangulateFixed(0, 1<<28, 0, 1<<28, points, edges, scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(verts)/2, 4+len(points)/2; got != want {
+			t.Fatalf("%d vertices, want %d", got, want)
+		}
+		// the triangles must be clockwise in font units:
+		units := make([][2]int64, len(verts)/2)
+		copy(units, [][2]int64{{0, 0}, {0, 1 << 28}, {1 << 28, 0}, {1 << 28, 1 << 28}})
+		for i, dstI := range srcToDstIs {
+			x, y := points[2*i], points[2*i+1]
+			units[dstI/2] = [2]int64{int64(x), int64(y)}
+			if verts[dstI] != float32(float64(x)*scale) || verts[dstI+1] != float32(float64(y)*scale) {
+				t.Fatalf("scale %v: point %d is %v", scale, i, verts[dstI:dstI+2])
+			}
+		}
+		for i := 0; i < len(triangles); i += 3 {
+			a, b, c := units[triangles[i]/2], units[triangles[i+1]/2], units[triangles[i+2]/2]
+			if (b[0]-a[0])*(c[1]-a[1])-(b[1]-a[1])*(c[0]-a[0]) >= 0 {
+				t.Fatalf("triangle %d %v isn't clockwise", i/3, triangles[i:i+3])
+			}
+		}
+	}
+}
+
+func benchmarkAddPoint(b *testing.B, n int) {
+	points := randomPoints(n)
+	for i := 0; i < b.N; i++ {
+		tri := NewTriangulation(-1, 2, -1, 2, n)
+		for j := 0; j < n; j++ {
+			if _, err := tri.AddPoint(points[2*j], points[2*j+1]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkAddEdge(b *testing.B, n int) {
+	points, edges := ringPoints(n)
+	// points in order around a circle are the worst case for incremental
+	// Delaunay triangulation, so add them in a random order:
+	order := rand.New(rand.NewSource(1)).Perm(n)
+	for i := 0; i < b.N; i++ {
+		tri := NewTriangulation(-1, 2, -1, 2, n)
+		is := make([]int, n)
+		for _, j := range order {
+			var err error
+			if is[j], err = tri.AddPoint(float64(points[2*j]), float64(points[2*j+1])); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for j := 0; j < len(edges); j += 2 {
+			if err := tri.AddEdge(is[edges[j]], is[edges[j+1]]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkAddLongEdge(b *testing.B, n int) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tri, from, to := stripPoints(b, n/2)
+		b.StartTimer()
+		if err := tri.AddEdge(from, to); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkTriangulate(b *testing.B, n int) {
+	points, edges := ringPoints(n)
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := Triangulate(-1, 2, -1, 2, points, edges); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAddPoint(b *testing.B) {
+	for _, n := range []int{1000, 4000, 16000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkAddPoint(b, n) })
+	}
+}
+
+func BenchmarkAddEdge(b *testing.B) {
+	for _, n := range []int{1000, 4000, 16000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkAddEdge(b, n) })
+	}
+}
+
+func BenchmarkAddLongEdge(b *testing.B) {
+	for _, n := range []int{1000, 4000, 16000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkAddLongEdge(b, n) })
+	}
+}
+
+func BenchmarkTriangulate(b *testing.B) {
+	for _, n := range []int{1000, 4000, 16000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) { benchmarkTriangulate(b, n) })
+	}
+}
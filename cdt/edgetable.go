@@ -0,0 +1,62 @@
+package cdt
+
+import (
+	"math/bits"
+)
+
+// An edgeTable maps pairs of vertices to values, so that replaceTriangles can
+// find half-edges and edges by their vertices in constant time.  It's a hash
+// table with open addressing whose slots are stamped with the generation they
+// were filled in, so that reset empties it in constant time.
+type edgeTable struct {
+	slots []edgeSlot
+	shift uint
+	gen   uint32
+}
+
+type edgeSlot struct {
+	a, b, value int32
+	gen         uint32
+}
+
+// reset empties the table, making room for n entries.
+func (h *edgeTable) reset(n int) {
+	h.gen++
+	if h.gen == 0 {
+		// the generation wrapped, so slots from the first may look current:
+		clear(h.slots)
+		h.gen = 1
+	}
+	// at most half full, so that probes stay short:
+	if len(h.slots) < 2*n || len(h.slots) < 16 {
+		size := max(16, 1<<bits.Len(uint(2*n-1)))
+		h.slots = make([]edgeSlot, size)
+		h.shift = uint(64 - bits.Len(uint(size-1)))
+	}
+}
+
+// slot returns the slot holding a, b, or else the empty slot where they go.
+func (h *edgeTable) slot(a, b int32) *edgeSlot {
+	mask := len(h.slots) - 1
+	i := int((uint64(uint32(a))<<32 | uint64(uint32(b))) * 0x9e3779b97f4a7c15 >> h.shift)
+	for {
+		s := &h.slots[i]
+		if s.gen != h.gen || s.a == a && s.b == b {
+			return s
+		}
+		i = (i + 1) & mask
+	}
+}
+
+// put sets the value for a, b.  Entries are removed by setting them to -1.
+func (h *edgeTable) put(a, b, value int) {
+	*h.slot(int32(a), int32(b)) = edgeSlot{int32(a), int32(b), int32(value), h.gen}
+}
+
+// get returns the value for a, b, or -1 if there isn't one.
+func (h *edgeTable) get(a, b int) int {
+	if s := h.slot(int32(a), int32(b)); s.gen == h.gen {
+		return int(s.value)
+	}
+	return -1
+}
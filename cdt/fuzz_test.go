@@ -0,0 +1,276 @@
+package cdt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// A triangulateFunc is an implementation of Triangulate.
+type triangulateFunc func(left, right, bottom, top float32,
+	points []float32, edges []int32) ([]float32, []int32, []int32, error)
+
+// implementations are the implementations of Triangulate checked by
+// FuzzTriangulate; the C++ one is added when it's built.
+var implementations = map[string]triangulateFunc{"go": triangulate}
+
+// fuzzInput converts the bytes of a fuzz input to points and constraint edges.
+// Each pair of bytes in pointBytes is a point on a 256x256 grid inside the unit
+// square, so that exactly collinear and cocircular points are common but every
+// coordinate is exact.  Each pair of bytes in edgeBytes joins two of the
+// points, skipping edges that would cross or overlap the edges before them.
+func fuzzInput(pointBytes, edgeBytes []byte) (points []float32, edges []int32) {
+	for i := 0; i+1 < len(pointBytes) && len(points) < 2*128; i += 2 {
+		points = append(points,
+			(float32(pointBytes[i])+0.5)/256, (float32(pointBytes[i+1])+0.5)/256)
+	}
+	n := len(points) / 2
+	if n < 2 {
+		return points, nil
+	}
+	pt := func(i int32) [2]float32 { return [2]float32{points[2*i], points[2*i+1]} }
+	for i := 0; i+1 < len(edgeBytes); i += 2 {
+		a, b := int32(int(edgeBytes[i])%n), int32(int(edgeBytes[i+1])%n)
+		pa, pb := pt(a), pt(b)
+		if pa == pb {
+			continue
+		}
+		ok := true
+		for j := 0; j < len(edges) && ok; j += 2 {
+			pc, pd := pt(edges[j]), pt(edges[j+1])
+			ok = !segmentsTouch(pa, pb, pc, pd)
+		}
+		if ok {
+			edges = append(edges, a, b)
+		}
+	}
+	return points, edges
+}
+
+// segmentsTouch reports whether the segments ab and cd intersect anywhere
+// other than at a shared endpoint.
+func segmentsTouch(a, b, c, d [2]float32) bool {
+	orient := func(p, q, r [2]float32) float64 {
+		return (float64(q[0])-float64(p[0]))*(float64(r[1])-float64(p[1])) -
+			(float64(q[1])-float64(p[1]))*(float64(r[0])-float64(p[0]))
+	}
+	// within reports whether r, collinear with pq, lies strictly between them:
+	within := func(p, q, r [2]float32) bool {
+		return r != p && r != q &&
+			min(p[0], q[0]) <= r[0] && r[0] <= max(p[0], q[0]) &&
+			min(p[1], q[1]) <= r[1] && r[1] <= max(p[1], q[1])
+	}
+	o1, o2 := orient(a, b, c), orient(a, b, d)
+	o3, o4 := orient(c, d, a), orient(c, d, b)
+	if o1*o2 < 0 && o3*o4 < 0 {
+		return true
+	}
+	shared := a == c || a == d || b == c || b == d
+	if o1 == 0 && o2 == 0 {
+		// collinear: they overlap unless they only meet at an endpoint
+		return within(a, b, c) || within(a, b, d) || within(c, d, a) || within(c, d, b) ||
+			(a == c && b == d) || (a == d && b == c)
+	}
+	if shared {
+		return false
+	}
+	return (o1 == 0 && within(a, b, c)) || (o2 == 0 && within(a, b, d)) ||
+		(o3 == 0 && within(c, d, a)) || (o4 == 0 && within(c, d, b))
+}
+
+// checkTriangulation returns an error unless verts and triangles, as returned
+// by Triangulate for points and edges inside the rectangle left, right,
+// bottom, top, are a constrained Delaunay triangulation of them.
+func checkTriangulation(left, right, bottom, top float32, points []float32, edges []int32,
+	verts []float32, srcToDstIs, triangles []int32) error {
+
+	numVerts := len(verts) / 2
+	if len(triangles) != 3*(2*numVerts-6) {
+		return fmt.Errorf("%d triangle indices for %d vertices", len(triangles), numVerts)
+	}
+	if len(srcToDstIs) != len(points)/2 {
+		return fmt.Errorf("%d source indices for %d points", len(srcToDstIs), len(points)/2)
+	}
+	vert := func(i int32) mgl32.Vec2 { return mgl32.Vec2{verts[i], verts[i+1]} }
+	vert64 := func(i int32) mgl64.Vec2 { return mgl64.Vec2{float64(verts[i]), float64(verts[i+1])} }
+	orient := func(a, b, c int32) float64 {
+		return (float64(verts[b])-float64(verts[a]))*(float64(verts[c+1])-float64(verts[a+1])) -
+			(float64(verts[b+1])-float64(verts[a+1]))*(float64(verts[c])-float64(verts[a]))
+	}
+	corners := []mgl32.Vec2{{left, bottom}, {left, top}, {right, bottom}, {right, top}}
+	for i, c := range corners {
+		if vert(int32(2*i)) != c {
+			return fmt.Errorf("corner %d is %v, want %v", i, vert(int32(2*i)), c)
+		}
+	}
+	for i, dstI := range srcToDstIs {
+		if dstI < 0 || int(dstI) >= len(verts) || dstI%2 != 0 {
+			return fmt.Errorf("point %d maps to index %d", i, dstI)
+		}
+		if got := vert(dstI); got != (mgl32.Vec2{points[2*i], points[2*i+1]}) {
+			return fmt.Errorf("point %d maps to %v", i, got)
+		}
+	}
+
+	// each half-edge must be used once, and have a twin unless it's on the
+	// boundary:
+	opposite := map[[2]int32]int32{}
+	neighbours := map[int32][]int32{}
+	for i := 0; i < len(triangles); i += 3 {
+		tri := triangles[i : i+3]
+		for _, v := range tri {
+			if v < 0 || int(v) >= len(verts) || v%2 != 0 {
+				return fmt.Errorf("triangle %d %v has a bad index", i/3, tri)
+			}
+		}
+		if orient(tri[0], tri[1], tri[2]) >= 0 {
+			return fmt.Errorf("triangle %d %v isn't clockwise", i/3, tri)
+		}
+		for j := 0; j < 3; j++ {
+			e := [2]int32{tri[j], tri[(j+1)%3]}
+			if _, ok := opposite[e]; ok {
+				return fmt.Errorf("half-edge %v is in two triangles", e)
+			}
+			opposite[e] = tri[(j+2)%3]
+			neighbours[e[0]] = append(neighbours[e[0]], e[1])
+		}
+	}
+	boundary := 0
+	for e := range opposite {
+		if _, ok := opposite[[2]int32{e[1], e[0]}]; !ok {
+			if e[0] >= 8 || e[1] >= 8 {
+				return fmt.Errorf("edge %v is on the boundary", e)
+			}
+			boundary++
+		}
+	}
+	if boundary != 4 {
+		return fmt.Errorf("%d edges on the boundary", boundary)
+	}
+
+	// each constraint must be a path of edges through the points on it:
+	constrained := map[[2]int32]bool{}
+	for i := 0; i < len(edges); i += 2 {
+		a, b := srcToDstIs[edges[i]], srcToDstIs[edges[i+1]]
+		for v := a; v != b; {
+			next := int32(-1)
+			for _, w := range neighbours[v] {
+				if orient(a, b, w) != 0 {
+					continue
+				}
+				// w must be further along the constraint than v:
+				ab := [2]float64{float64(verts[b] - verts[a]), float64(verts[b+1] - verts[a+1])}
+				along := func(p int32) float64 {
+					return ab[0]*float64(verts[p]-verts[a]) + ab[1]*float64(verts[p+1]-verts[a+1])
+				}
+				if along(w) > along(v) && along(w) <= along(b) {
+					next = w
+				}
+			}
+			if next < 0 {
+				return fmt.Errorf("edge %d, %d is missing", edges[i], edges[i+1])
+			}
+			constrained[[2]int32{v, next}] = true
+			constrained[[2]int32{next, v}] = true
+			v = next
+		}
+	}
+
+	// and every other edge must be locally Delaunay:
+	for e, c := range opposite {
+		d, ok := opposite[[2]int32{e[1], e[0]}]
+		if !ok || constrained[e] {
+			continue
+		}
+		if inCircumcircle(vert64(e[0]), vert64(e[1]), vert64(c), vert64(d)) {
+			return fmt.Errorf("edge %v isn't Delaunay", e)
+		}
+	}
+	return nil
+}
+
+func FuzzTriangulate(f *testing.F) {
+	f.Add([]byte{10, 10, 200, 20, 100, 240, 120, 100}, []byte{0, 1, 1, 2, 2, 0})
+	// points along a line, with a constraint through them:
+	f.Add([]byte{10, 10, 50, 50, 90, 90, 130, 130, 20, 200, 200, 20}, []byte{0, 3, 4, 5})
+	// a grid, where every point is cocircular with its neighbours:
+	grid := []byte{}
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 5; y++ {
+			grid = append(grid, byte(40*x+20), byte(40*y+20))
+		}
+	}
+	f.Add(grid, []byte{0, 24, 4, 20, 1, 2, 7, 13})
+	points, edges := ringPoints(64)
+	ringBytes := []byte{}
+	for _, p := range points {
+		ringBytes = append(ringBytes, byte(p*256))
+	}
+	edgeBytes := []byte{}
+	for _, e := range edges {
+		edgeBytes = append(edgeBytes, byte(e))
+	}
+	f.Add(ringBytes, edgeBytes)
+
+	f.Fuzz(func(t *testing.T, pointBytes, edgeBytes []byte) {
+		points, edges := fuzzInput(pointBytes, edgeBytes)
+		for name, triangulate := range implementations {
+			verts, srcToDstIs, triangles, err := triangulate(-1, 2, -1, 2, points, edges)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err := checkTriangulation(-1, 2, -1, 2, points, edges,
+				verts, srcToDstIs, triangles); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	})
+}
+
+// FuzzConstraintPolicy adds edges that may cross each other, under each
+// ConstraintPolicy, checking the triangulation after each one.
+func FuzzConstraintPolicy(f *testing.F) {
+	f.Add([]byte{10, 10, 200, 20, 100, 240, 120, 100, 30, 200, 220, 200},
+		[]byte{0, 1, 2, 3, 4, 5, 0, 5}, byte(ConstraintSplit))
+	// the split moves off the crossed edge when rounded:
+	f.Add([]byte("022\xf0100X00"), []byte("1890"), byte(ConstraintSplit))
+	// a split where the edge passes through vertices on both sides:
+	f.Add([]byte("0000X00000 00\x000000000000000000001000710 001100"), []byte("bCa0"),
+		byte(ConstraintSplit))
+
+	f.Fuzz(func(t *testing.T, pointBytes, edgeBytes []byte, policy byte) {
+		points, _ := fuzzInput(pointBytes, nil)
+		n := len(points) / 2
+		if n < 2 || len(edgeBytes) > 2*32 {
+			return
+		}
+		tri := NewTriangulation(-1, 2, -1, 2, n)
+		tri.Policy = ConstraintPolicy(policy % 3)
+		is := make([]int, n)
+		for i := range is {
+			var err error
+			if is[i], err = tri.AddPoint(float64(points[2*i]), float64(points[2*i+1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i+1 < len(edgeBytes); i += 2 {
+			a, b := is[int(edgeBytes[i])%n], is[int(edgeBytes[i+1])%n]
+			if a == b {
+				continue
+			}
+			err := tri.AddEdge(a, b)
+			// splits between vertices an ulp apart may never resolve:
+			if err == ErrNonTermination && tri.Policy == ConstraintSplit {
+				err = nil
+			}
+			if err != nil && err != ErrIntersectingEdges {
+				t.Fatalf("edge %d, %d: %v", a, b, err)
+			}
+			if err := tri.Validate(); err != nil {
+				t.Fatalf("edge %d, %d: %v", a, b, err)
+			}
+		}
+	})
+}
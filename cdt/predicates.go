@@ -0,0 +1,185 @@
+package cdt
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// The predicates here follow Shewchuk, "Adaptive Precision Floating-Point
+// Arithmetic and Fast Robust Geometric Predicates".  Each is evaluated in
+// float64 first, and only when the result is too close to 0 for its error
+// bound to settle the sign is it evaluated again exactly, as an expansion: a
+// sum of float64s, in increasing order of magnitude, whose bits don't overlap.
+
+const (
+	// epsilon is half the distance from 1 to the next float64.
+	epsilon = 1.0 / (1 << 53)
+	// bounds on the error of the float64 orient and inCircle, relative to
+	// the sum of the magnitudes of their terms:
+	orientErrBound   = (3 + 16*epsilon) * epsilon
+	inCircleErrBound = (10 + 96*epsilon) * epsilon
+)
+
+// orient returns a positive number if c is to the left of the line from a to b,
+// a negative number if it is to the right, and 0 if a, b and c are collinear.
+// The sign is always exact.
+func orient(a, b, c mgl64.Vec2) float64 {
+	left := (b[0] - a[0]) * (c[1] - a[1])
+	right := (b[1] - a[1]) * (c[0] - a[0])
+	det := left - right
+	if math.Abs(det) >= orientErrBound*(math.Abs(left)+math.Abs(right)) {
+		return det
+	}
+	return estimate(orientExact(a, b, c))
+}
+
+// orientExact returns the determinant computed by orient as an expansion.
+func orientExact(a, b, c mgl64.Vec2) []float64 {
+	det := twoProduct(a[0], b[1])
+	det = sumExpansions(det, twoProduct(-a[0], c[1]))
+	det = sumExpansions(det, twoProduct(-a[1], b[0]))
+	det = sumExpansions(det, twoProduct(a[1], c[0]))
+	det = sumExpansions(det, twoProduct(b[0], c[1]))
+	return sumExpansions(det, twoProduct(-b[1], c[0]))
+}
+
+// inCircle returns true if d is inside the circumcircle of the clockwise
+// triangle abc.  Points exactly on the circle are outside, so that flipping an
+// edge can't be undone by the opposite test.
+func inCircle(a, b, c, d mgl64.Vec2) bool {
+	adx, ady := a[0]-d[0], a[1]-d[1]
+	bdx, bdy := b[0]-d[0], b[1]-d[1]
+	cdx, cdy := c[0]-d[0], c[1]-d[1]
+	alift := adx*adx + ady*ady
+	blift := bdx*bdx + bdy*bdy
+	clift := cdx*cdx + cdy*cdy
+	det := alift*(bdx*cdy-cdx*bdy) + blift*(cdx*ady-adx*cdy) + clift*(adx*bdy-bdx*ady)
+	permanent := alift*(math.Abs(bdx*cdy)+math.Abs(cdx*bdy)) +
+		blift*(math.Abs(cdx*ady)+math.Abs(adx*cdy)) +
+		clift*(math.Abs(adx*bdy)+math.Abs(bdx*ady))
+	if math.Abs(det) <= inCircleErrBound*permanent {
+		det = estimate(inCircleExact(a, b, c, d))
+	}
+	// the determinant is positive for d inside a counter-clockwise triangle:
+	return det < 0
+}
+
+// inCircleExact returns the determinant computed by inCircle as an expansion.
+// It's the determinant of the rows x, y, x^2 + y^2, 1 for a, b, c and d,
+// expanded along the third column.
+func inCircleExact(a, b, c, d mgl64.Vec2) []float64 {
+	pts := [4]mgl64.Vec2{a, b, c, d}
+	det := []float64{0}
+	for i := range pts {
+		// the other three points, in order:
+		var p, q, r mgl64.Vec2
+		switch i {
+		case 0:
+			p, q, r = pts[1], pts[2], pts[3]
+		case 1:
+			p, q, r = pts[0], pts[2], pts[3]
+		case 2:
+			p, q, r = pts[0], pts[1], pts[3]
+		case 3:
+			p, q, r = pts[0], pts[1], pts[2]
+		}
+		minor := orientExact(p, q, r)
+		lift := sumExpansions(
+			twoProduct(pts[i][0], pts[i][0]), twoProduct(pts[i][1], pts[i][1]))
+		term := multiplyExpansions(lift, minor)
+		if i%2 == 1 {
+			for j := range term {
+				term[j] = -term[j]
+			}
+		}
+		det = sumExpansions(det, term)
+	}
+	return det
+}
+
+// twoSum returns a + b and the error in it.
+func twoSum(a, b float64) (sum, err float64) {
+	sum = a + b
+	bv := sum - a
+	av := sum - bv
+	return sum, (a - av) + (b - bv)
+}
+
+// twoProduct returns a*b exactly as an expansion.
+func twoProduct(a, b float64) []float64 {
+	p := a * b
+	return []float64{math.FMA(a, b, -p), p}
+}
+
+// growExpansion returns the expansion e + b, dropping zeros.
+func growExpansion(e []float64, b float64) []float64 {
+	h := make([]float64, 0, len(e)+1)
+	q := b
+	for _, x := range e {
+		var err float64
+		q, err = twoSum(q, x)
+		if err != 0 {
+			h = append(h, err)
+		}
+	}
+	if q != 0 || len(h) == 0 {
+		h = append(h, q)
+	}
+	return h
+}
+
+// sumExpansions returns the expansion e + f.
+func sumExpansions(e, f []float64) []float64 {
+	for _, x := range f {
+		e = growExpansion(e, x)
+	}
+	return e
+}
+
+// scaleExpansion returns the expansion e*b, dropping zeros.
+func scaleExpansion(e []float64, b float64) []float64 {
+	h := make([]float64, 0, 2*len(e))
+	var q float64
+	for i, x := range e {
+		p := twoProduct(x, b)
+		if i == 0 {
+			q = p[1]
+			if p[0] != 0 {
+				h = append(h, p[0])
+			}
+			continue
+		}
+		sum, err := twoSum(q, p[0])
+		if err != 0 {
+			h = append(h, err)
+		}
+		q, err = twoSum(p[1], sum)
+		if err != 0 {
+			h = append(h, err)
+		}
+	}
+	if q != 0 || len(h) == 0 {
+		h = append(h, q)
+	}
+	return h
+}
+
+// multiplyExpansions returns the expansion e*f.
+func multiplyExpansions(e, f []float64) []float64 {
+	h := []float64{0}
+	for _, x := range f {
+		h = sumExpansions(h, scaleExpansion(e, x))
+	}
+	return h
+}
+
+// estimate returns the float64 nearest to the expansion e, or near enough to
+// have the same sign.
+func estimate(e []float64) float64 {
+	var sum float64
+	for _, x := range e {
+		sum += x
+	}
+	return sum
+}
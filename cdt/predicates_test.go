@@ -0,0 +1,99 @@
+package cdt
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// exactOrient returns the sign of orient(a, b, c) computed with rationals.
+func exactOrient(a, b, c mgl64.Vec2) int {
+	r := func(x float64) *big.Rat { return new(big.Rat).SetFloat64(x) }
+	bax := new(big.Rat).Sub(r(b[0]), r(a[0]))
+	bay := new(big.Rat).Sub(r(b[1]), r(a[1]))
+	cax := new(big.Rat).Sub(r(c[0]), r(a[0]))
+	cay := new(big.Rat).Sub(r(c[1]), r(a[1]))
+	left := new(big.Rat).Mul(bax, cay)
+	return left.Sub(left, new(big.Rat).Mul(bay, cax)).Sign()
+}
+
+// exactInCircle returns the sign of the determinant tested by inCircle,
+// computed with rationals.
+func exactInCircle(a, b, c, d mgl64.Vec2) int {
+	r := func(x float64) *big.Rat { return new(big.Rat).SetFloat64(x) }
+	var rows [3][3]*big.Rat
+	for i, p := range []mgl64.Vec2{a, b, c} {
+		x := new(big.Rat).Sub(r(p[0]), r(d[0]))
+		y := new(big.Rat).Sub(r(p[1]), r(d[1]))
+		lift := new(big.Rat).Mul(x, x)
+		lift.Add(lift, new(big.Rat).Mul(y, y))
+		rows[i] = [3]*big.Rat{x, y, lift}
+	}
+	minor := func(i, j int) *big.Rat {
+		m := new(big.Rat).Mul(rows[i][0], rows[j][1])
+		return m.Sub(m, new(big.Rat).Mul(rows[j][0], rows[i][1]))
+	}
+	det := new(big.Rat).Mul(rows[0][2], minor(1, 2))
+	det.Sub(det, new(big.Rat).Mul(rows[1][2], minor(0, 2)))
+	det.Add(det, new(big.Rat).Mul(rows[2][2], minor(0, 1)))
+	return det.Sign()
+}
+
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+func TestOrient(t *testing.T) {
+	// points within a few ulps of the line through q and r, where rounding
+	// r - p gets the sign wrong:
+	q, r := mgl64.Vec2{0x1p40, 0x1p40}, mgl64.Vec2{0x3p40, 0x3p40}
+	for i := 0; i < 32; i++ {
+		for j := 0; j < 32; j++ {
+			p := mgl64.Vec2{0.75 + float64(i)*0x1p-24, 0.75 + float64(j)*0x1p-24}
+			if got, want := sign(orient(p, q, r)), exactOrient(p, q, r); got != want {
+				t.Fatalf("orient(%v, %v, %v) has sign %d, want %d", p, q, r, got, want)
+			}
+		}
+	}
+}
+
+func TestInCircle(t *testing.T) {
+	// points exactly on the circle of radius 5 are outside every triangle
+	// of the others:
+	circle := []mgl64.Vec2{{5, 0}, {4, -3}, {3, -4}, {0, -5}, {-4, -3}, {-5, 0},
+		{-3, 4}, {0, 5}, {4, 3}}
+	for i := 0; i+3 < len(circle); i++ {
+		// circle is clockwise:
+		a, b, c := circle[i], circle[i+1], circle[i+2]
+		for _, d := range circle[i+3:] {
+			if inCircle(a, b, c, d) {
+				t.Errorf("%v is inside the circumcircle of %v, %v, %v", d, a, b, c)
+			}
+			// and a point just inside the circle is inside:
+			in := mgl64.Vec2{
+				d[0] - float64(sign(d[0]))*0x1p-20,
+				d[1] - float64(sign(d[1]))*0x1p-20}
+			if !inCircle(a, b, c, in) {
+				t.Errorf("%v isn't inside the circumcircle of %v, %v, %v", in, a, b, c)
+			}
+		}
+	}
+	// points along the tangent at (0, 0) to the circle through a, b and c,
+	// which are too close to it to tell with float64 arithmetic:
+	a, b, c := mgl64.Vec2{1, 0}, mgl64.Vec2{0, 1}, mgl64.Vec2{1, 1}
+	for k := -16; k <= 16; k++ {
+		for m := -16; m <= 16; m++ {
+			d := mgl64.Vec2{float64(k) * 0x1p-30, float64(-k)*0x1p-30 + float64(m)*0x1p-60}
+			if got, want := inCircle(a, b, c, d), exactInCircle(a, b, c, d) < 0; got != want {
+				t.Fatalf("inCircle(%v, %v, %v, %v) = %v, want %v", a, b, c, d, got, want)
+			}
+		}
+	}
+}
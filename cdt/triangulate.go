@@ -0,0 +1,16 @@
+//go:build !(cdt_cpp && cgo)
+
+package cdt
+
+// Triangulate computes the constrained Delaunay triangulation of points, given
+// as x, y pairs, with the edges given as pairs of indices into points.  All of
+// the points must lie inside the rectangle defined by left, right, bottom and
+// top.  The returned srcToDstIs and triangles index into verts, which holds x,
+// y pairs; verts begins with the four corners of the bounding rectangle.
+//
+// Triangulate uses the Go implementation unless the package is built with cgo
+// and the cdt_cpp build tag, which select the C++ implementation in cdt.cpp.
+func Triangulate(left, right, bottom, top float32,
+	points []float32, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+	return triangulate(left, right, bottom, top, points, edges)
+}
@@ -0,0 +1,83 @@
+//go:build cdt_cpp && cgo
+
+package cdt
+
+// #cgo CXXFLAGS: -O3 -std=c++11 -Wall -Werror
+// #cgo LDFLAGS: -lm
+// #include <stdlib.h>
+// int triangulate(float left, float right, float bottom, float top,
+//                 int nPoints, float *points, int nEdges, int *edges,
+//                 float *verts, int *srcToDstIs, int *triangles);
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// error codes returned by the C++ triangulate; these must match cdt.cpp.
+const (
+	errOutOfBounds     = -1
+	errDegenerateGraph = -2
+	errNonTermination  = -3
+)
+
+// Triangulate computes the constrained Delaunay triangulation of points, given
+// as x, y pairs, with the edges given as pairs of indices into points.  All of
+// the points must lie inside the rectangle defined by left, right, bottom and
+// top.  The returned srcToDstIs and triangles index into verts, which holds x,
+// y pairs; verts begins with the four corners of the bounding rectangle.
+//
+// This build uses the C++ implementation in cdt.cpp, selected by the cdt_cpp
+// build tag.
+func Triangulate(left, right, bottom, top float32,
+	points []float32, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+	return triangulateCpp(left, right, bottom, top, points, edges)
+}
+
+// triangulateCpp is the C++ implementation of Triangulate.
+func triangulateCpp(left, right, bottom, top float32,
+	points []float32, edges []int32) (verts []float32, srcToDstIs []int32, triangles []int32, err error) {
+
+	numPoints := (len(points) / 2) + 4
+	// the C++ side may not keep pointers to Go memory, so everything goes
+	// through C buffers:
+	cPoints := (*C.float)(C.malloc(C.size_t(max(len(points), 1) * 4)))
+	defer C.free(unsafe.Pointer(cPoints))
+	copy(unsafe.Slice((*float32)(unsafe.Pointer(cPoints)), len(points)), points)
+	cEdges := (*C.int)(C.malloc(C.size_t(max(len(edges), 1) * 4)))
+	defer C.free(unsafe.Pointer(cEdges))
+	copy(unsafe.Slice((*int32)(unsafe.Pointer(cEdges)), len(edges)), edges)
+	cSrcToDstIs := (*C.int)(C.malloc(C.size_t(max(len(points)/2, 1) * 4)))
+	defer C.free(unsafe.Pointer(cSrcToDstIs))
+	cVerts := (*C.float)(C.malloc(C.size_t(numPoints * 2 * 4)))
+	defer C.free(unsafe.Pointer(cVerts))
+	cTriangles := (*C.int)(C.malloc(C.size_t(3 * (2*numPoints - 6) * 4)))
+	defer C.free(unsafe.Pointer(cTriangles))
+
+	result := C.triangulate(
+		C.float(left), C.float(right), C.float(bottom), C.float(top),
+		C.int(int32(len(points)/2)), cPoints,
+		C.int(int32(len(edges)/2)), cEdges,
+		cVerts, cSrcToDstIs, cTriangles)
+	switch {
+	case result == errOutOfBounds:
+		return nil, nil, nil, ErrOutOfBounds
+	case result == errDegenerateGraph:
+		return nil, nil, nil, ErrDegenerateGraph
+	case result == errNonTermination:
+		return nil, nil, nil, ErrNonTermination
+	case result < 0:
+		return nil, nil, nil, fmt.Errorf("cdt: triangulate failed with error %d", result)
+	}
+	// the result is the number of floats in verts, which is fewer than
+	// allocated in case of duplicates:
+	numFloats := int(result)
+	srcToDstIs = make([]int32, len(points)/2)
+	copy(srcToDstIs, unsafe.Slice((*int32)(unsafe.Pointer(cSrcToDstIs)), len(srcToDstIs)))
+	verts = make([]float32, numFloats)
+	copy(verts, unsafe.Slice((*float32)(unsafe.Pointer(cVerts)), numFloats))
+	triangles = make([]int32, 3*(numFloats-6))
+	copy(triangles, unsafe.Slice((*int32)(unsafe.Pointer(cTriangles)), len(triangles)))
+	return verts, srcToDstIs, triangles, nil
+}
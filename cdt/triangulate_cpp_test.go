@@ -0,0 +1,7 @@
+//go:build cdt_cpp && cgo
+
+package cdt
+
+func init() {
+	implementations["cpp"] = triangulateCpp
+}
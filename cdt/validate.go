@@ -0,0 +1,104 @@
+package cdt
+
+import (
+	"fmt"
+)
+
+// Validate checks that t is a constrained Delaunay triangulation, returning
+// an error describing the first problem found.  It checks that:
+//
+//   - every triangle is clockwise and Halfedges links it to its neighbours
+//   - every edge in Edges is stored sorted, and is the side of a triangle
+//   - only fixed edges have a winding
+//   - every side of a triangle is in Edges
+//   - the counts of vertices, edges and triangles satisfy Euler's formula
+//   - the circumcircle of every triangle holds no vertex across an edge that
+//     isn't fixed
+//
+// Validate takes time linear in the size of t, so it is meant for tests and
+// debugging rather than for every call to AddPoint or AddEdge.
+func (t *Triangulation) Validate() error {
+	if t.TriangleI%3 != 0 || t.EdgeI%2 != 0 {
+		return fmt.Errorf("cdt: %d triangle indices and %d edge indices",
+			t.TriangleI, t.EdgeI)
+	}
+	for i := 0; i < t.TriangleI; i += 3 {
+		tri := t.Triangles[i : i+3]
+		for _, v := range tri {
+			if v < 0 || v >= t.VertI {
+				return fmt.Errorf("cdt: triangle %d %v has a bad vertex", i/3, tri)
+			}
+		}
+		if orient(t.Verts[tri[0]], t.Verts[tri[1]], t.Verts[tri[2]]) >= 0 {
+			return fmt.Errorf("cdt: triangle %d %v isn't clockwise", i/3, tri)
+		}
+	}
+
+	edges := make(map[[2]int]int, t.EdgeI/2)
+	for i := 0; i < t.EdgeI; i += 2 {
+		a, b := t.Edges[i], t.Edges[i+1]
+		if a >= b {
+			return fmt.Errorf("cdt: edge %d (%d, %d) isn't sorted", i/2, a, b)
+		}
+		if t.winding[i/2] != 0 && !t.fixed[i/2] {
+			return fmt.Errorf("cdt: edge %d (%d, %d) has winding %d but isn't fixed",
+				i/2, a, b, t.winding[i/2])
+		}
+		if j, ok := edges[[2]int{a, b}]; ok {
+			return fmt.Errorf("cdt: edges %d and %d are both (%d, %d)", j/2, i/2, a, b)
+		}
+		edges[[2]int{a, b}] = i
+	}
+	sides := 0
+	for e := 0; e < t.TriangleI; e++ {
+		a, b := t.Triangles[e], t.Triangles[NextHalfedge(e)]
+		edgeI, ok := edges[[2]int{min(a, b), max(a, b)}]
+		if !ok {
+			return fmt.Errorf("cdt: side (%d, %d) of triangle %d isn't in Edges", a, b, e/3)
+		}
+		if t.edgeOf[e] != edgeI {
+			return fmt.Errorf("cdt: side (%d, %d) of triangle %d refers to edge %d, not %d",
+				a, b, e/3, t.edgeOf[e]/2, edgeI/2)
+		}
+		twin := t.Halfedges[e]
+		if twin < 0 {
+			continue
+		}
+		if twin >= t.TriangleI || t.Halfedges[twin] != e ||
+			t.Triangles[twin] != b || t.Triangles[NextHalfedge(twin)] != a {
+			return fmt.Errorf("cdt: side (%d, %d) of triangle %d has a bad twin %d", a, b, e/3, twin)
+		}
+		if e < twin {
+			sides++
+		}
+	}
+	boundary := 0
+	for e := 0; e < t.TriangleI; e++ {
+		if t.Halfedges[e] < 0 {
+			boundary++
+		}
+	}
+	if sides+boundary != t.EdgeI/2 {
+		return fmt.Errorf("cdt: %d edges, but triangles have %d distinct sides",
+			t.EdgeI/2, sides+boundary)
+	}
+	// V - E + F = 2, counting the outside as a face:
+	if v, e, f := t.VertI, t.EdgeI/2, t.TriangleI/3+1; v-e+f != 2 {
+		return fmt.Errorf("cdt: %d vertices, %d edges and %d faces break Euler's formula", v, e, f)
+	}
+
+	for e := 0; e < t.TriangleI; e++ {
+		twin := t.Halfedges[e]
+		if twin < e || t.fixed[t.edgeOf[e]/2] {
+			continue
+		}
+		a, b := t.Triangles[e], t.Triangles[NextHalfedge(e)]
+		c := t.Triangles[PrevHalfedge(e)]
+		d := t.Triangles[PrevHalfedge(twin)]
+		if inCircle(t.Verts[a], t.Verts[b], t.Verts[c], t.Verts[d]) {
+			return fmt.Errorf("cdt: vertex %d is inside the circumcircle of triangle %d %v",
+				d, e/3, t.Triangles[e-e%3:e-e%3+3])
+		}
+	}
+	return nil
+}
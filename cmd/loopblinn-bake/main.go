@@ -0,0 +1,239 @@
+/*
+Command loopblinn-bake triangulates the glyphs of a TrueType or OpenType font
+ahead of time and writes their meshes to a bundle that package glyphmesh can
+Decode, or read in place with a BundleView.  Fonts with CFF outlines are read
+with package sfnt, and their cubic curves converted to quadratics.
+
+Usage:
+
+	loopblinn-bake [flags] -o out.lbgm font.ttf
+
+The runes to bake are the union of -runes, -text and -all; with none of them,
+printable ASCII is baked.  -runes takes a comma-separated list of runes and
+ranges, each written as a number (U+AC00, 0xac00 or 44032) or a single
+non-digit character, such as "U+20-U+7E,U+AC00-U+D7A3" or "a-z".
+
+Glyphs that fail to mesh are reported and left out of the bundle, and the exit
+status is then 1.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+	"golang.org/x/image/font/sfnt"
+
+	"github.com/Mischanix/loopblinn/glyphmesh"
+)
+
+var (
+	outPath   = flag.String("o", "", "output bundle `path`")
+	runeList  = flag.String("runes", "", "comma-separated runes and rune ranges to bake")
+	textPath  = flag.String("text", "", "bake every rune in the text `file`")
+	allGlyphs = flag.Bool("all", false, "bake every rune mapped by the font's cmap")
+	indexBits = flag.Int("index", 0, "index width, 16 or 32 (default: the narrowest that fits)")
+	prune     = flag.Bool("prune", false, "leave out the triangles outside each glyph")
+	verbose   = flag.Bool("v", false, "report each glyph baked")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: loopblinn-bake [flags] -o out.lbgm font.ttf\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "loopblinn-bake: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || *outPath == "" {
+		usage()
+	}
+
+	buf, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	mesher, err := newMesher(buf)
+	if err != nil {
+		fatalf("parsing %s: %v", flag.Arg(0), err)
+	}
+
+	runes := map[rune]bool{}
+	if *runeList != "" {
+		if err := parseRuneList(*runeList, runes); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if *textPath != "" {
+		text, err := ioutil.ReadFile(*textPath)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for _, r := range string(text) {
+			if !unicode.IsControl(r) && r != utf8.RuneError {
+				runes[r] = true
+			}
+		}
+	}
+	if *allGlyphs {
+		// neither truetype nor sfnt exposes the cmap, so probe every code
+		// point:
+		for r := rune(0); r <= unicode.MaxRune; r++ {
+			if mesher.Index(r) != 0 {
+				runes[r] = true
+			}
+		}
+	}
+	if *runeList == "" && *textPath == "" && !*allGlyphs {
+		for r := rune(0x20); r < 0x7f; r++ {
+			runes[r] = true
+		}
+	}
+	sorted := make([]rune, 0, len(runes))
+	for r := range runes {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mesher.PruneExterior = *prune
+	switch *indexBits {
+	case 0:
+	case 16:
+		mesher.IndexFormat = glyphmesh.Index16
+	case 32:
+		mesher.IndexFormat = glyphmesh.Index32
+	default:
+		fatalf("-index must be 16 or 32")
+	}
+
+	bundle := &glyphmesh.Bundle{}
+	meshes := map[truetype.Index]*glyphmesh.GlyphMesh{}
+	failed := map[truetype.Index]bool{}
+	missing, failures := 0, 0
+	for _, r := range sorted {
+		index := mesher.Index(r)
+		if index == 0 {
+			missing++
+			continue
+		}
+		mesh, ok := meshes[index]
+		if !ok && !failed[index] {
+			mesh, err = mesher.MeshIndex(index)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "loopblinn-bake: %U: %v\n", r, err)
+				failed[index] = true
+			} else {
+				meshes[index] = mesh
+			}
+		}
+		if failed[index] {
+			failures++
+			continue
+		}
+		if *verbose {
+			stats := mesh.Stats()
+			fmt.Fprintf(os.Stderr, "%U %q: %d vertices (%d before welding), %d triangles (%d pruned)\n",
+				r, r, len(mesh.UVs()), stats.Vertices, len(mesh.Indices())/3, stats.PrunedTriangles)
+		}
+		bundle.Add(r, index, mesh)
+	}
+
+	var out bytes.Buffer
+	if err := glyphmesh.Encode(&out, bundle); err != nil {
+		fatalf("%v", err)
+	}
+	if err := ioutil.WriteFile(*outPath, out.Bytes(), 0644); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "baked %d runes (%d glyphs) to %s, %d bytes",
+		len(bundle.Glyphs), len(meshes), *outPath, out.Len())
+	if missing > 0 {
+		fmt.Fprintf(os.Stderr, "; %d runes not in font", missing)
+	}
+	fmt.Fprintln(os.Stderr)
+	if failures > 0 {
+		fatalf("%d runes failed to mesh", failures)
+	}
+}
+
+// newMesher returns a Mesher for the font in buf.  OpenType fonts with CFF
+// outlines begin with "OTTO", and package truetype can't read them.
+func newMesher(buf []byte) (*glyphmesh.Mesher, error) {
+	if bytes.HasPrefix(buf, []byte("OTTO")) {
+		font, err := sfnt.Parse(buf)
+		if err != nil {
+			return nil, err
+		}
+		return glyphmesh.NewSFNTMesher(font), nil
+	}
+	font, err := truetype.Parse(buf)
+	if err != nil {
+		return nil, err
+	}
+	return glyphmesh.NewMesher(font), nil
+}
+
+// parseRuneList adds the runes given by list to runes.
+func parseRuneList(list string, runes map[rune]bool) error {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi := item, item
+		// a lone "-" is a rune, not a range:
+		if i := strings.Index(item[1:], "-"); i >= 0 {
+			lo, hi = item[:i+1], item[i+2:]
+		}
+		first, err := parseRune(lo)
+		if err != nil {
+			return err
+		}
+		last, err := parseRune(hi)
+		if err != nil {
+			return err
+		}
+		if last < first {
+			return fmt.Errorf("empty rune range %q", item)
+		}
+		for r := first; r <= last; r++ {
+			runes[r] = true
+		}
+	}
+	return nil
+}
+
+// parseRune parses U+hex, a number in Go syntax, or a single non-digit
+// character.
+func parseRune(s string) (rune, error) {
+	if utf8.RuneCountInString(s) == 1 && (s[0] < '0' || s[0] > '9') {
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	}
+	var n int64
+	var err error
+	if strings.HasPrefix(s, "U+") || strings.HasPrefix(s, "u+") {
+		n, err = strconv.ParseInt(s[2:], 16, 32)
+	} else {
+		n, err = strconv.ParseInt(s, 0, 32)
+	}
+	if err != nil || n < 0 || n > unicode.MaxRune {
+		return 0, fmt.Errorf("bad rune %q", s)
+	}
+	return rune(n), nil
+}
@@ -0,0 +1,365 @@
+package glyphmesh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// A Bundle holds precomputed meshes for the glyphs of a font, so that a font
+// can be triangulated offline and loaded at runtime with Decode.
+type Bundle struct {
+	// Glyphs are kept sorted by rune.
+	Glyphs []BundleGlyph
+}
+
+// BundleGlyph is the mesh of a single rune in a Bundle.
+type BundleGlyph struct {
+	Rune  rune
+	Index truetype.Index
+	Mesh  *GlyphMesh
+}
+
+// Add adds the mesh for r, which is glyph index in the font, to the bundle.
+// A mesh added for several runes is stored only once when encoded.
+func (b *Bundle) Add(r rune, index truetype.Index, mesh *GlyphMesh) {
+	i := sort.Search(len(b.Glyphs), func(i int) bool { return b.Glyphs[i].Rune >= r })
+	if i < len(b.Glyphs) && b.Glyphs[i].Rune == r {
+		b.Glyphs[i] = BundleGlyph{r, index, mesh}
+		return
+	}
+	b.Glyphs = append(b.Glyphs, BundleGlyph{})
+	copy(b.Glyphs[i+1:], b.Glyphs[i:])
+	b.Glyphs[i] = BundleGlyph{r, index, mesh}
+}
+
+// Mesh returns the mesh for r, or nil if r isn't in the bundle.
+func (b *Bundle) Mesh(r rune) *GlyphMesh {
+	i := sort.Search(len(b.Glyphs), func(i int) bool { return b.Glyphs[i].Rune >= r })
+	if i < len(b.Glyphs) && b.Glyphs[i].Rune == r {
+		return b.Glyphs[i].Mesh
+	}
+	return nil
+}
+
+/*
+The bundle format is little-endian throughout, and every array is aligned to 4
+bytes so that a reader can use a memory-mapped file in place, as BundleView
+does:
+
+	header, 16 bytes:
+		magic      [4]byte  "LBGM"
+		version    uint16   bundleVersion
+		flags      uint16   0
+		numGlyphs  uint32
+		reserved   uint32   0
+	glyph records, 48 bytes each, sorted by rune:
+		rune       uint32
+		index      uint32
+		advance    float32
+		bounds     [4]float32  xMin, yMin, xMax, yMax
+		numVerts   uint32
+		numIndices uint32
+		indexSize  uint32  2 or 4
+		dataOffset uint32  from the start of the file
+		reserved   uint32  0
+	mesh data, at each record's dataOffset:
+		positions  [2*numVerts]float32
+		uvs        [numVerts]int8, zero-padded to a multiple of 4 bytes
+		indices    [numIndices]uint16 or uint32, zero-padded likewise
+
+Records for runes that were added with the same mesh share its mesh data, and
+are identical apart from their rune and index.
+*/
+const (
+	bundleMagic        = "LBGM"
+	bundleVersion      = 1
+	bundleHeaderSize   = 16
+	bundleRecordSize   = 48
+	bundleMaxGlyphs    = 1 << 24
+	bundleMaxMeshItems = 1 << 28
+)
+
+var (
+	// ErrBadBundle is returned by Decode and NewBundleView for data that
+	// isn't a well-formed bundle.
+	ErrBadBundle = errors.New("glyphmesh: malformed bundle")
+	// ErrBundleVersion is returned by Decode and NewBundleView for bundles
+	// written by an incompatible version of Encode.
+	ErrBundleVersion = errors.New("glyphmesh: unsupported bundle version")
+)
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// meshDataSize returns the number of bytes of mesh data stored for a mesh.
+func meshDataSize(numVerts, numIndices int, format IndexFormat) int {
+	return 8*numVerts + align4(numVerts) + align4(format.Size()*numIndices)
+}
+
+// Encode writes b to w in the bundle format.
+func Encode(w io.Writer, b *Bundle) error {
+	le := binary.LittleEndian
+	header := make([]byte, bundleHeaderSize+bundleRecordSize*len(b.Glyphs))
+	copy(header, bundleMagic)
+	le.PutUint16(header[4:], bundleVersion)
+	le.PutUint32(header[8:], uint32(len(b.Glyphs)))
+
+	// lay out the mesh data, sharing it between runes with the same mesh:
+	offset := len(header)
+	offsets := make(map[*GlyphMesh]int)
+	var meshes []*GlyphMesh
+	for i, g := range b.Glyphs {
+		if i > 0 && g.Rune <= b.Glyphs[i-1].Rune {
+			return fmt.Errorf("glyphmesh: bundle glyphs not sorted at %q", g.Rune)
+		}
+		if g.Mesh.format != Index16 && g.Mesh.format != Index32 {
+			return fmt.Errorf("glyphmesh: mesh for %q has no index format", g.Rune)
+		}
+		dataOffset, ok := offsets[g.Mesh]
+		if !ok {
+			dataOffset = offset
+			offsets[g.Mesh] = offset
+			offset += meshDataSize(len(g.Mesh.uvs), len(g.Mesh.indices), g.Mesh.format)
+			meshes = append(meshes, g.Mesh)
+		}
+		m := g.Mesh
+		record := header[bundleHeaderSize+bundleRecordSize*i:]
+		le.PutUint32(record[0:], uint32(g.Rune))
+		le.PutUint32(record[4:], uint32(g.Index))
+		le.PutUint32(record[8:], math.Float32bits(m.advance))
+		for j, f := range m.bounds {
+			le.PutUint32(record[12+4*j:], math.Float32bits(f))
+		}
+		le.PutUint32(record[28:], uint32(len(m.uvs)))
+		le.PutUint32(record[32:], uint32(len(m.indices)))
+		le.PutUint32(record[36:], uint32(m.format.Size()))
+		le.PutUint32(record[40:], uint32(dataOffset))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, m := range meshes {
+		data := make([]byte, meshDataSize(len(m.uvs), len(m.indices), m.format))
+		n := 0
+		for _, f := range m.positions {
+			le.PutUint32(data[n:], math.Float32bits(f))
+			n += 4
+		}
+		for _, uv := range m.uvs {
+			data[n] = byte(uv)
+			n++
+		}
+		n = align4(n)
+		for _, idx := range m.indices {
+			if m.format == Index16 {
+				le.PutUint16(data[n:], uint16(idx))
+				n += 2
+			} else {
+				le.PutUint32(data[n:], idx)
+				n += 4
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a bundle written by Encode from data.  The meshes returned
+// don't refer to data, so data may be unmapped or reused afterwards; to use
+// the mesh data in place instead, see NewBundleView.
+func Decode(data []byte) (*Bundle, error) {
+	v, err := NewBundleView(data)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{Glyphs: make([]BundleGlyph, v.Len())}
+	meshes := make(map[string]*GlyphMesh)
+	for i := range b.Glyphs {
+		g := v.Glyph(i)
+		m, ok := meshes[g.key]
+		if !ok {
+			m = g.mesh()
+			meshes[g.key] = m
+		}
+		b.Glyphs[i] = BundleGlyph{g.Rune, g.Index, m}
+	}
+	return b, nil
+}
+
+// A BundleView reads a bundle written by Encode in place, without copying
+// its meshes, so that a memory-mapped bundle's mesh data can be handed
+// straight to the GPU.  The slices of the GlyphViews it returns point in to
+// the data it reads, and must be treated as read-only.
+type BundleView struct {
+	data      []byte
+	numGlyphs int
+}
+
+// GlyphView is the mesh of a single rune in a BundleView, with its arrays as
+// they're encoded, in little-endian byte order.
+type GlyphView struct {
+	Rune    rune
+	Index   truetype.Index
+	Advance float32
+	// xMin, yMin, xMax, yMax
+	Bounds [4]float32
+	// Format is Index16 or Index32.
+	Format IndexFormat
+	// Positions holds a float32 x, y pair for each vertex, UVs an int8 for
+	// each vertex, and Indices a uint16 or uint32 for each index, depending
+	// on Format.
+	Positions, UVs, Indices []byte
+
+	// key is the part of the record from the advance to the data offset.
+	// Glyphs with the same key share their mesh data; an empty mesh has the
+	// same offset as the mesh after it, but not the same counts.
+	key string
+}
+
+// NewBundleView checks that data holds a well-formed bundle, and returns a
+// view of it.
+func NewBundleView(data []byte) (*BundleView, error) {
+	le := binary.LittleEndian
+	if len(data) < bundleHeaderSize || string(data[:4]) != bundleMagic {
+		return nil, ErrBadBundle
+	}
+	if le.Uint16(data[4:]) != bundleVersion {
+		return nil, ErrBundleVersion
+	}
+	numGlyphs := int(le.Uint32(data[8:]))
+	if numGlyphs > bundleMaxGlyphs ||
+		len(data) < bundleHeaderSize+bundleRecordSize*numGlyphs {
+		return nil, ErrBadBundle
+	}
+
+	checked := make(map[string]bool)
+	var prev rune
+	for i := 0; i < numGlyphs; i++ {
+		record := data[bundleHeaderSize+bundleRecordSize*i:]
+		r := rune(le.Uint32(record[0:]))
+		if i > 0 && r <= prev {
+			return nil, ErrBadBundle
+		}
+		prev = r
+		key := string(record[8:44])
+		if checked[key] {
+			continue
+		}
+		numVerts := int(le.Uint32(record[28:]))
+		numIndices := int(le.Uint32(record[32:]))
+		format := Index16
+		switch le.Uint32(record[36:]) {
+		case 2:
+		case 4:
+			format = Index32
+		default:
+			return nil, ErrBadBundle
+		}
+		if numVerts > bundleMaxMeshItems || numIndices > bundleMaxMeshItems {
+			return nil, ErrBadBundle
+		}
+		dataOffset := int(le.Uint32(record[40:]))
+		if dataOffset%4 != 0 || dataOffset > len(data) ||
+			len(data)-dataOffset < meshDataSize(numVerts, numIndices, format) {
+			return nil, ErrBadBundle
+		}
+
+		n := dataOffset + 8*numVerts + align4(numVerts)
+		for j := 0; j < numIndices; j++ {
+			var idx uint32
+			if format == Index16 {
+				idx = uint32(le.Uint16(data[n:]))
+				n += 2
+			} else {
+				idx = le.Uint32(data[n:])
+				n += 4
+			}
+			if int(idx) >= numVerts {
+				return nil, ErrBadBundle
+			}
+		}
+		checked[key] = true
+	}
+	return &BundleView{data, numGlyphs}, nil
+}
+
+// Len returns the number of glyphs in the bundle.
+func (v *BundleView) Len() int {
+	return v.numGlyphs
+}
+
+// Glyph returns the ith glyph of the bundle, in order of rune.
+func (v *BundleView) Glyph(i int) GlyphView {
+	le := binary.LittleEndian
+	record := v.data[bundleHeaderSize+bundleRecordSize*i:]
+	g := GlyphView{
+		Rune:    rune(le.Uint32(record[0:])),
+		Index:   truetype.Index(le.Uint32(record[4:])),
+		Advance: math.Float32frombits(le.Uint32(record[8:])),
+		Format:  Index16,
+		key:     string(record[8:44]),
+	}
+	for j := range g.Bounds {
+		g.Bounds[j] = math.Float32frombits(le.Uint32(record[12+4*j:]))
+	}
+	if le.Uint32(record[36:]) == 4 {
+		g.Format = Index32
+	}
+	numVerts := int(le.Uint32(record[28:]))
+	numIndices := int(le.Uint32(record[32:]))
+	n := int(le.Uint32(record[40:]))
+	g.Positions = v.data[n : n+8*numVerts : n+8*numVerts]
+	n += 8 * numVerts
+	g.UVs = v.data[n : n+numVerts : n+numVerts]
+	n += align4(numVerts)
+	end := n + g.Format.Size()*numIndices
+	g.Indices = v.data[n:end:end]
+	return g
+}
+
+// Lookup returns the glyph for r, and whether r is in the bundle.
+func (v *BundleView) Lookup(r rune) (GlyphView, bool) {
+	le := binary.LittleEndian
+	i := sort.Search(v.numGlyphs, func(i int) bool {
+		return rune(le.Uint32(v.data[bundleHeaderSize+bundleRecordSize*i:])) >= r
+	})
+	if i < v.numGlyphs {
+		if g := v.Glyph(i); g.Rune == r {
+			return g, true
+		}
+	}
+	return GlyphView{}, false
+}
+
+// mesh returns a copy of g's mesh.
+func (g GlyphView) mesh() *GlyphMesh {
+	le := binary.LittleEndian
+	m := &GlyphMesh{format: g.Format, advance: g.Advance, bounds: g.Bounds}
+	m.positions = make([]float32, len(g.Positions)/4)
+	for j := range m.positions {
+		m.positions[j] = math.Float32frombits(le.Uint32(g.Positions[4*j:]))
+	}
+	m.uvs = make([]int8, len(g.UVs))
+	for j, uv := range g.UVs {
+		m.uvs[j] = int8(uv)
+	}
+	m.indices = make([]uint32, len(g.Indices)/g.Format.Size())
+	for j := range m.indices {
+		if g.Format == Index16 {
+			m.indices[j] = uint32(le.Uint16(g.Indices[2*j:]))
+		} else {
+			m.indices[j] = le.Uint32(g.Indices[4*j:])
+		}
+	}
+	return m
+}
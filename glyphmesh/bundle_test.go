@@ -0,0 +1,208 @@
+package glyphmesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testBundle returns a bundle of a few glyphs, with both index formats, and
+// with 'Z' sharing the glyph of 'A'.
+func testBundle(t *testing.T) *Bundle {
+	font := loadTestFont(t)
+	mesher := NewMesher(font)
+	wide := NewMesher(font)
+	wide.IndexFormat = Index32
+	b := &Bundle{}
+	for _, r := range "gAQ께" {
+		m := mesher
+		if r == 'Q' {
+			m = wide
+		}
+		mesh, err := m.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Add(r, font.Index(r), mesh)
+	}
+	b.Add('Z', font.Index('A'), b.Mesh('A'))
+	return b
+}
+
+func encodeBundle(t *testing.T, b *Bundle) []byte {
+	var buf bytes.Buffer
+	if err := Encode(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sameMesh reports whether a decoded mesh matches the mesh that was encoded.
+func sameMesh(decoded, encoded *GlyphMesh) bool {
+	// the stats aren't encoded:
+	m := *encoded
+	m.stats = MeshStats{}
+	return fmt.Sprintf("%+v", *decoded) == fmt.Sprintf("%+v", m)
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	b := testBundle(t)
+	if got, want := len(b.Glyphs), 5; got != want {
+		t.Fatalf("%d glyphs, want %d", got, want)
+	}
+	for i := 1; i < len(b.Glyphs); i++ {
+		if b.Glyphs[i].Rune <= b.Glyphs[i-1].Rune {
+			t.Fatalf("glyphs aren't sorted: %q after %q", b.Glyphs[i].Rune, b.Glyphs[i-1].Rune)
+		}
+	}
+	if b.Mesh('x') != nil {
+		t.Errorf("Mesh returned a mesh for a rune that isn't in the bundle")
+	}
+
+	data := encodeBundle(t, b)
+	// the mesh shared by 'A' and 'Z' is stored once:
+	size := bundleHeaderSize + bundleRecordSize*len(b.Glyphs)
+	for _, g := range b.Glyphs {
+		if g.Rune != 'Z' {
+			size += meshDataSize(len(g.Mesh.uvs), len(g.Mesh.indices), g.Mesh.format)
+		}
+	}
+	if len(data) != size {
+		t.Errorf("encoded %d bytes, want %d", len(data), size)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Glyphs) != len(b.Glyphs) {
+		t.Fatalf("decoded %d glyphs, want %d", len(decoded.Glyphs), len(b.Glyphs))
+	}
+	for i, g := range decoded.Glyphs {
+		want := b.Glyphs[i]
+		if g.Rune != want.Rune || g.Index != want.Index {
+			t.Errorf("glyph %d is %q, index %d, want %q, index %d",
+				i, g.Rune, g.Index, want.Rune, want.Index)
+		}
+		if !sameMesh(g.Mesh, want.Mesh) {
+			t.Errorf("%q: decoded mesh differs from the mesh encoded", g.Rune)
+		}
+	}
+	if decoded.Mesh('A') != decoded.Mesh('Z') {
+		t.Errorf("'A' and 'Z' don't share their decoded mesh")
+	}
+	if got := decoded.Mesh('Q').IndexFormat(); got != Index32 {
+		t.Errorf("'Q' decoded with index format %v, want Index32", got)
+	}
+}
+
+func TestBundleSharing(t *testing.T) {
+	font := loadTestFont(t)
+	pruned := NewMesher(font)
+	pruned.PruneExterior = true
+	pruned.IndexFormat = Index32
+	mesh := func(mesher *Mesher, r rune) *GlyphMesh {
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	b := &Bundle{}
+	b.Add(' ', font.Index(' '), mesh(NewMesher(font), ' '))
+	b.Add('A', font.Index('A'), mesh(NewMesher(font), 'A'))
+	b.Add('B', font.Index('A'), mesh(pruned, 'A'))
+	if len(b.Mesh(' ').UVs()) != 0 {
+		t.Fatalf("the mesh for ' ' isn't empty")
+	}
+
+	// the empty mesh for ' ' has the same data offset as the mesh for 'A',
+	// and the meshes of 'A' and 'B' share a glyph index, but none of them
+	// share their data:
+	decoded, err := Decode(encodeBundle(t, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range b.Glyphs {
+		if m := decoded.Mesh(g.Rune); !sameMesh(m, g.Mesh) {
+			t.Errorf("%q: decoded mesh differs from the mesh encoded", g.Rune)
+		}
+	}
+}
+
+func TestBundleView(t *testing.T) {
+	b := testBundle(t)
+	data := encodeBundle(t, b)
+	v, err := NewBundleView(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Len() != len(b.Glyphs) {
+		t.Fatalf("the view has %d glyphs, want %d", v.Len(), len(b.Glyphs))
+	}
+	for i, want := range b.Glyphs {
+		g := v.Glyph(i)
+		m := want.Mesh
+		if g.Rune != want.Rune || g.Index != want.Index || g.Advance != m.advance ||
+			g.Bounds != m.bounds || g.Format != m.format {
+			t.Errorf("glyph %d is %+v, want %q, index %d", i, g, want.Rune, want.Index)
+		}
+		if !sameMesh(g.mesh(), m) {
+			t.Errorf("%q: the viewed mesh differs from the mesh encoded", g.Rune)
+		}
+		// the arrays are read in place:
+		dataOffset := binary.LittleEndian.Uint32(data[bundleHeaderSize+bundleRecordSize*i+40:])
+		if &g.Positions[0] != &data[dataOffset] {
+			t.Errorf("%q: the positions aren't in the bundle's data", g.Rune)
+		}
+	}
+	a, _ := v.Lookup('A')
+	z, ok := v.Lookup('Z')
+	if !ok || z.Rune != 'Z' || &z.Indices[0] != &a.Indices[0] {
+		t.Errorf("'A' and 'Z' don't share their mesh data")
+	}
+	if _, ok := v.Lookup('x'); ok {
+		t.Errorf("Lookup found a rune that isn't in the bundle")
+	}
+}
+
+func TestDecodeBad(t *testing.T) {
+	data := encodeBundle(t, testBundle(t))
+	for n := 0; n < len(data); n++ {
+		if _, err := Decode(data[:n]); err != ErrBadBundle {
+			t.Fatalf("truncated to %d bytes: got %v, want ErrBadBundle", n, err)
+		}
+	}
+
+	le := binary.LittleEndian
+	// the first glyph's record, and the first index of its mesh:
+	record := bundleHeaderSize
+	dataOffset := int(le.Uint32(data[record+40:]))
+	numVerts := int(le.Uint32(data[record+28:]))
+	firstIndex := dataOffset + 8*numVerts + align4(numVerts)
+	for _, test := range []struct {
+		name    string
+		corrupt func(data []byte)
+		err     error
+	}{
+		{"magic", func(data []byte) { data[0] = 'X' }, ErrBadBundle},
+		{"version", func(data []byte) { le.PutUint16(data[4:], bundleVersion+1) }, ErrBundleVersion},
+		{"glyph count", func(data []byte) { le.PutUint32(data[8:], 1<<20) }, ErrBadBundle},
+		{"unsorted runes", func(data []byte) {
+			le.PutUint32(data[record+bundleRecordSize:], le.Uint32(data[record:]))
+		}, ErrBadBundle},
+		{"index size", func(data []byte) { le.PutUint32(data[record+36:], 3) }, ErrBadBundle},
+		{"unaligned data", func(data []byte) { le.PutUint32(data[record+40:], uint32(dataOffset+1)) }, ErrBadBundle},
+		{"data past the end", func(data []byte) { le.PutUint32(data[record+40:], uint32(len(data))) }, ErrBadBundle},
+		{"vertex count", func(data []byte) { le.PutUint32(data[record+28:], 1<<30) }, ErrBadBundle},
+		{"index out of range", func(data []byte) { le.PutUint16(data[firstIndex:], uint16(numVerts)) }, ErrBadBundle},
+	} {
+		corrupted := append([]byte(nil), data...)
+		test.corrupt(corrupted)
+		if _, err := Decode(corrupted); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package glyphmesh
+
+import (
+	"container/list"
+	"sync"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// A Cache holds finished GlyphMeshes keyed by font and glyph index.  Once the
+// meshes held exceed the cache's memory budget, the least recently used meshes
+// are evicted.  A Cache is safe for concurrent use, so it can be shared by
+// Meshers running on different goroutines.
+type Cache struct {
+	mu      sync.Mutex
+	budget  int
+	size    int
+	lru     *list.List // of *cacheEntry, most recently used at the front
+	entries map[cacheKey]*list.Element
+	stats   CacheStats
+}
+
+// CacheStats reports the state of a Cache.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+	// Meshes is the number of meshes held, and Bytes is their approximate
+	// total size.
+	Meshes, Bytes int
+}
+
+// cacheKey identifies a mesh.  Fonts are identified by pointer, to either a
+// truetype.Font or an sfnt.Font, so a font parsed twice is cached twice.  The
+// Mesher's options are part of the key since meshes built with different
+// options aren't interchangeable.
+type cacheKey struct {
+	font      interface{}
+	index     truetype.Index
+	format    IndexFormat
+	prune     bool
+	tolerance float32
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	mesh *GlyphMesh
+	size int
+}
+
+// NewCache returns a Cache that holds meshes totalling approximately budget
+// bytes.
+func NewCache(budget int) *Cache {
+	return &Cache{
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Stats returns the cache's hit and miss counters along with its current size.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Meshes = c.lru.Len()
+	stats.Bytes = c.size
+	return stats
+}
+
+// Purge removes every mesh from the cache.  The counters are left as they are.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.size = 0
+}
+
+func (c *Cache) get(key cacheKey) *GlyphMesh {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).mesh
+}
+
+func (c *Cache) put(key cacheKey, mesh *GlyphMesh) {
+	size := mesh.byteSize()
+	if size > c.budget {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		// another goroutine meshed the same glyph first
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, mesh, size})
+	c.size += size
+	for c.size > c.budget {
+		elem := c.lru.Back()
+		entry := elem.Value.(*cacheEntry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		c.stats.Evictions++
+	}
+}
+
+// byteSize returns the approximate number of bytes of memory used by m.
+func (m *GlyphMesh) byteSize() int {
+	const overhead = 96 // struct and slice headers
+	return overhead + 4*len(m.positions) + len(m.uvs) + 4*len(m.indices)
+}
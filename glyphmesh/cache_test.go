@@ -0,0 +1,156 @@
+package glyphmesh
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCacheHits(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	mesher.Cache = NewCache(1 << 20)
+	first, err := mesher.Mesh('A')
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mesher.Mesh('A')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("the second Mesh wasn't served from the cache")
+	}
+	want := CacheStats{Hits: 1, Misses: 1, Meshes: 1, Bytes: first.byteSize()}
+	if got := mesher.Cache.Stats(); got != want {
+		t.Errorf("stats are %+v, want %+v", got, want)
+	}
+
+	mesher.Cache.Purge()
+	want = CacheStats{Hits: 1, Misses: 1}
+	if got := mesher.Cache.Stats(); got != want {
+		t.Errorf("stats after Purge are %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	font := loadTestFont(t)
+	sizes := map[rune]int{}
+	for _, r := range "AgQ" {
+		m, err := NewMesher(font).Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[r] = m.byteSize()
+	}
+	// room for any two of the meshes, but not all three:
+	budget := sizes['A'] + sizes['g'] + sizes['Q'] - 1
+	mesher := NewMesher(font)
+	mesher.Cache = NewCache(budget)
+	meshes := map[rune]*GlyphMesh{}
+	for _, r := range "AgAQ" {
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meshes[r] = m
+	}
+	// 'A' was used after 'g', so 'g' is evicted to make room for 'Q':
+	stats := mesher.Cache.Stats()
+	if stats.Evictions != 1 || stats.Meshes != 2 || stats.Bytes != sizes['A']+sizes['Q'] {
+		t.Errorf("stats are %+v after filling the cache", stats)
+	}
+	if stats.Bytes > budget {
+		t.Errorf("the cache holds %d bytes, over its budget of %d", stats.Bytes, budget)
+	}
+	for _, r := range "AQg" {
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached := m == meshes[r]; cached != (r != 'g') {
+			t.Errorf("%q: cached is %v", r, cached)
+		}
+	}
+
+	// a mesh larger than the whole budget isn't cached:
+	mesher.Cache = NewCache(sizes['Q'] - 1)
+	if _, err := mesher.Mesh('Q'); err != nil {
+		t.Fatal(err)
+	}
+	if stats := mesher.Cache.Stats(); stats.Meshes != 0 || stats.Evictions != 0 {
+		t.Errorf("stats are %+v after meshing a glyph over budget", stats)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	font := loadTestFont(t)
+	cache := NewCache(1 << 20)
+	newMesher := func() *Mesher {
+		m := NewMesher(font)
+		m.Cache = cache
+		return m
+	}
+	plain := newMesher()
+	wide := newMesher()
+	wide.IndexFormat = Index32
+	pruned := newMesher()
+	pruned.PruneExterior = true
+	// the same font parsed again is cached apart:
+	other := NewMesher(loadTestFont(t))
+	other.Cache = cache
+
+	seen := map[*GlyphMesh]bool{}
+	for _, mesher := range []*Mesher{plain, wide, pruned, other} {
+		m, err := mesher.Mesh('A')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[m] {
+			t.Errorf("Meshers with different options share a cached mesh")
+		}
+		seen[m] = true
+	}
+	if stats := cache.Stats(); stats.Misses != 4 || stats.Hits != 0 || stats.Meshes != 4 {
+		t.Errorf("stats are %+v", stats)
+	}
+	if m, err := wide.Mesh('A'); err != nil || m.IndexFormat() != Index32 {
+		t.Errorf("the cached mesh for Index32 has format %v, %v", m.IndexFormat(), err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("meshing again missed the cache: %+v", stats)
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	font := loadTestFont(t)
+	cache := NewCache(1 << 16)
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// a Mesher isn't safe for concurrent use, but its Cache is:
+			mesher := NewMesher(font)
+			mesher.Cache = cache
+			for _, r := range "AQgo께" {
+				if _, err := mesher.Mesh(r); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	stats := cache.Stats()
+	if got, want := stats.Hits+stats.Misses, uint64(workers*len([]rune("AQgo께"))); got != want {
+		t.Errorf("%d lookups, want %d", got, want)
+	}
+	if stats.Bytes > 1<<16 {
+		t.Errorf("the cache holds %d bytes, over its budget", stats.Bytes)
+	}
+}
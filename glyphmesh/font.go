@@ -0,0 +1,225 @@
+package glyphmesh
+
+import (
+	"errors"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultCubicTolerance is the CubicTolerance used when a Mesher's is 0.
+const DefaultCubicTolerance = 1.0 / 4096
+
+// ErrCubicTolerance is returned when a Mesher's CubicTolerance is negative or
+// NaN.
+var ErrCubicTolerance = errors.New("glyphmesh: CubicTolerance must be positive")
+
+// A glyphSource loads glyphs from a font for a Mesher.  Glyph metrics are in
+// ems.
+type glyphSource interface {
+	// index returns the index of the glyph for r, or 0 if there isn't one.
+	index(r rune) truetype.Index
+	// load returns the outline of a glyph, with cubic curves converted to
+	// quadratics within tolerance, along with its advance and bounds.
+	load(index truetype.Index, tolerance float32) (o *Outline, advance float32,
+		bounds [4]float32, err error)
+	// kerning returns the kerning between the glyphs a and b.
+	kerning(a, b truetype.Index) float32
+}
+
+// trueTypeSource loads glyphs with package truetype.
+type trueTypeSource struct {
+	font  *truetype.Font
+	glyph *truetype.GlyphBuf
+}
+
+func (s *trueTypeSource) index(r rune) truetype.Index {
+	return s.font.Index(r)
+}
+
+func (s *trueTypeSource) load(index truetype.Index, tolerance float32) (*Outline,
+	float32, [4]float32, error) {
+
+	if err := s.glyph.Load(s.font, 65536, index, truetype.NoHinting); err != nil {
+		return nil, 0, [4]float32{}, err
+	}
+	b := s.glyph.B
+	bounds := [4]float32{
+		float32(b.XMin) / 65536, float32(b.YMin) / 65536,
+		float32(b.XMax) / 65536, float32(b.YMax) / 65536}
+	advance := float32(s.font.HMetric(65536, index).AdvanceWidth) / 65536
+	return outlineFromGlyph(s.glyph), advance, bounds, nil
+}
+
+func (s *trueTypeSource) kerning(a, b truetype.Index) float32 {
+	return float32(s.font.Kerning(65536, a, b)) / 65536
+}
+
+// sfntSource loads glyphs with package sfnt, which reads both TrueType and
+// CFF outlines.  Glyphs are loaded with a ppem of the font's units per em, so
+// that their 26.6 fixed point coordinates are in font units and keep the
+// font's precision; sfnt scales in 32 bits, which a larger ppem overflows.
+type sfntSource struct {
+	font *sfnt.Font
+	buf  sfnt.Buffer
+	ppem fixed.Int26_6
+}
+
+func newSFNTSource(font *sfnt.Font) *sfntSource {
+	return &sfntSource{font: font, ppem: fixed.I(int(font.UnitsPerEm()))}
+}
+
+// fromFixed converts a coordinate loaded at s.ppem to ems.
+func (s *sfntSource) fromFixed(x fixed.Int26_6) float32 {
+	return float32(x) / float32(s.ppem)
+}
+
+func (s *sfntSource) index(r rune) truetype.Index {
+	index, err := s.font.GlyphIndex(&s.buf, r)
+	if err != nil {
+		return 0
+	}
+	return truetype.Index(index)
+}
+
+func (s *sfntSource) load(index truetype.Index, tolerance float32) (*Outline,
+	float32, [4]float32, error) {
+
+	x := sfnt.GlyphIndex(index)
+	segments, err := s.font.LoadGlyph(&s.buf, x, s.ppem, nil)
+	if err != nil {
+		return nil, 0, [4]float32{}, err
+	}
+	b, advance, err := s.font.GlyphBounds(&s.buf, x, s.ppem, font.HintingNone)
+	if err != nil {
+		return nil, 0, [4]float32{}, err
+	}
+	// sfnt's y axis points down:
+	point := func(p fixed.Point26_6) mgl32.Vec2 {
+		return mgl32.Vec2{s.fromFixed(p.X), -s.fromFixed(p.Y)}
+	}
+	bounds := [4]float32{
+		s.fromFixed(b.Min.X), -s.fromFixed(b.Max.Y), s.fromFixed(b.Max.X), -s.fromFixed(b.Min.Y)}
+
+	o := &Outline{}
+	var c Contour
+	var start, p0 mgl32.Vec2
+	closeContour := func() {
+		if p0 != start {
+			c = append(c, Segment{p0, p0.Add(start).Mul(0.5), start, true})
+		}
+		if len(c) > 0 {
+			o.Contours = append(o.Contours, c)
+		}
+		c = nil
+	}
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			closeContour()
+			start = point(seg.Args[0])
+			p0 = start
+		case sfnt.SegmentOpLineTo:
+			p2 := point(seg.Args[0])
+			if p2 != p0 {
+				c = append(c, Segment{p0, p0.Add(p2).Mul(0.5), p2, true})
+			}
+			p0 = p2
+		case sfnt.SegmentOpQuadTo:
+			p2 := point(seg.Args[1])
+			c = append(c, Segment{p0, point(seg.Args[0]), p2, false})
+			p0 = p2
+		case sfnt.SegmentOpCubeTo:
+			p3 := point(seg.Args[2])
+			c = appendCubic(c, p0, point(seg.Args[0]), point(seg.Args[1]), p3, tolerance)
+			p0 = p3
+		}
+	}
+	closeContour()
+	// CFF outer contours run counter-clockwise, the other way to TrueType's,
+	// which the Mesher expects:
+	if o.area() > 0 {
+		o.reverse()
+	}
+	return o, s.fromFixed(advance), bounds, nil
+}
+
+// area returns the signed area of the polygon through the points of o, which
+// is positive when its outer contours run counter-clockwise.
+func (o *Outline) area() float32 {
+	var a float32
+	for _, c := range o.Contours {
+		for _, s := range c {
+			a += s.P0[0]*s.P1[1] - s.P1[0]*s.P0[1] + s.P1[0]*s.P2[1] - s.P2[0]*s.P1[1]
+		}
+	}
+	return a / 2
+}
+
+// reverse reverses the direction of every contour of o.
+func (o *Outline) reverse() {
+	for _, c := range o.Contours {
+		for i, j := 0, len(c)-1; i <= j; i, j = i+1, j-1 {
+			c[i], c[j] = Segment{c[j].P2, c[j].P1, c[j].P0, c[j].Line},
+				Segment{c[i].P2, c[i].P1, c[i].P0, c[i].Line}
+		}
+	}
+}
+
+func (s *sfntSource) kerning(a, b truetype.Index) float32 {
+	k, err := s.font.Kern(&s.buf, sfnt.GlyphIndex(a), sfnt.GlyphIndex(b), s.ppem,
+		font.HintingNone)
+	if err != nil {
+		// including sfnt.ErrNotFound, for fonts without kerning
+		return 0
+	}
+	return s.fromFixed(k)
+}
+
+// maxCubicPieces limits the number of quadratic curves that appendCubic
+// replaces a cubic with, which is far more than any curve in a font needs for
+// a useful tolerance.
+const maxCubicPieces = 64
+
+// appendCubic appends to c quadratic curves that stay within tolerance of the
+// cubic Bézier curve from p0 to p3 with control points p1 and p2.  A cubic is
+// approximated by the quadratic with the same ends whose control point is the
+// average of where the cubic's end tangents lead; that quadratic strays from
+// the cubic by at most √3/36 |p3 - 3p2 + 3p1 - p0|.  Splitting the cubic in to
+// n even pieces divides that bound by n^3, so it's split in to the fewest
+// pieces that bring the bound within tolerance, but no more than
+// maxCubicPieces.
+func appendCubic(c Contour, p0, p1, p2, p3 mgl32.Vec2, tolerance float32) Contour {
+	d := p3.Sub(p2.Mul(3)).Add(p1.Mul(3)).Sub(p0)
+	bound := float64(d.Len()) * math.Sqrt(3) / 36
+	n := int(math.Ceil(math.Cbrt(bound / float64(tolerance))))
+	n = min(max(n, 1), maxCubicPieces)
+	for k := n; k > 0; k-- {
+		// split off the first 1/k of what's left, with de Casteljau's
+		// algorithm:
+		t := 1 / float32(k)
+		p01 := lerp(p0, p1, t)
+		p12 := lerp(p1, p2, t)
+		p23 := lerp(p2, p3, t)
+		p012 := lerp(p01, p12, t)
+		p123 := lerp(p12, p23, t)
+		mid := lerp(p012, p123, t)
+		if k == 1 {
+			mid = p3
+		}
+		control := p01.Mul(3).Sub(p0).Add(p012.Mul(3)).Sub(mid).Mul(0.25)
+		c = append(c, Segment{p0, control, mid, false})
+		p0, p1, p2 = mid, p123, p23
+	}
+	return c
+}
+
+// lerp returns the point t of the way from a to b.
+func lerp(a, b mgl32.Vec2, t float32) mgl32.Vec2 {
+	return a.Add(b.Sub(a).Mul(t))
+}
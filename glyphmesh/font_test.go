@@ -0,0 +1,146 @@
+package glyphmesh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// cffRunes are the runes in testdata/CFFTest.otf, whose outlines are cubic.
+const cffRunes = "01中Q"
+
+func loadCFFFont(t testing.TB) *sfnt.Font {
+	buf, err := ioutil.ReadFile("testdata/CFFTest.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := sfnt.Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+func TestCFF(t *testing.T) {
+	font := loadCFFFont(t)
+	mesher := NewSFNTMesher(font)
+	src := newSFNTSource(font)
+	cubics := 0
+	for _, r := range cffRunes {
+		index := mesher.Index(r)
+		if index == 0 {
+			t.Fatalf("%q isn't in the font", r)
+		}
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := mesher.Outline(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateMesh(o, m); err != nil {
+			t.Errorf("%q: %v", r, err)
+		}
+
+		// the quadratics stay close to the cubics they replace:
+		segments, err := font.LoadGlyph(&src.buf, sfnt.GlyphIndex(index), src.ppem, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		point := func(i, j int) mgl32.Vec2 {
+			p := segments[i].Args[j]
+			return mgl32.Vec2{src.fromFixed(p.X), -src.fromFixed(p.Y)}
+		}
+		var p0 mgl32.Vec2
+		for i, seg := range segments {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo, sfnt.SegmentOpLineTo:
+				p0 = point(i, 0)
+			case sfnt.SegmentOpQuadTo:
+				p0 = point(i, 1)
+			case sfnt.SegmentOpCubeTo:
+				p1, p2, p3 := point(i, 0), point(i, 1), point(i, 2)
+				for k := 0; k <= 64; k++ {
+					s := float32(k) / 64
+					p := p0.Mul((1 - s) * (1 - s) * (1 - s)).
+						Add(p1.Mul(3 * (1 - s) * (1 - s) * s)).
+						Add(p2.Mul(3 * (1 - s) * s * s)).
+						Add(p3.Mul(s * s * s))
+					if !o.near(p, DefaultCubicTolerance+validateTolerance/4) {
+						t.Fatalf("%q: %v on cubic %d isn't within %v of the outline",
+							r, p, i, DefaultCubicTolerance)
+					}
+				}
+				p0 = p3
+				cubics++
+			}
+		}
+	}
+	if cubics == 0 {
+		t.Errorf("no cubic curves in %q", cffRunes)
+	}
+}
+
+func TestGoldenCFF(t *testing.T) {
+	mesher := NewSFNTMesher(loadCFFFont(t))
+	for _, r := range cffRunes {
+		name := fmt.Sprintf("CFF-%U", r)
+		t.Run(name, func(t *testing.T) {
+			m, err := mesher.Mesh(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name, renderGolden(m))
+		})
+	}
+}
+
+func TestAppendCubic(t *testing.T) {
+	p0, p1, p2, p3 := mgl32.Vec2{0, 0}, mgl32.Vec2{0, 1}, mgl32.Vec2{1, 1}, mgl32.Vec2{1, 0}
+	for _, test := range []struct {
+		tolerance float32
+		pieces    int
+	}{
+		{1, 1},
+		// √3/36 |p3 - 3p2 + 3p1 - p0| = √3/18 is 0.096, which 7 pieces bring
+		// to 0.00028 and 8 to 0.00019:
+		{0.0003, 7},
+		{0.0002, 8},
+		{1e-30, maxCubicPieces},
+	} {
+		c := appendCubic(nil, p0, p1, p2, p3, test.tolerance)
+		if len(c) != test.pieces {
+			t.Errorf("tolerance %v: %d pieces, want %d", test.tolerance, len(c), test.pieces)
+			continue
+		}
+		// the pieces run end to end from p0 to p3:
+		if c[0].P0 != p0 || c[len(c)-1].P2 != p3 {
+			t.Errorf("tolerance %v: pieces run from %v to %v", test.tolerance, c[0].P0, c[len(c)-1].P2)
+		}
+		for i := 1; i < len(c); i++ {
+			if c[i].P0 != c[i-1].P2 {
+				t.Errorf("tolerance %v: piece %d doesn't start where %d ends", test.tolerance, i, i-1)
+			}
+		}
+	}
+}
+
+func TestCubicTolerance(t *testing.T) {
+	mesher := NewSFNTMesher(loadCFFFont(t))
+	for _, tolerance := range []float32{-1, float32(math.NaN())} {
+		mesher.CubicTolerance = tolerance
+		if _, err := mesher.Mesh('0'); !errors.Is(err, ErrCubicTolerance) {
+			t.Errorf("CubicTolerance %v: Mesh returned %v", tolerance, err)
+		}
+		if _, err := mesher.Outline('0'); !errors.Is(err, ErrCubicTolerance) {
+			t.Errorf("CubicTolerance %v: Outline returned %v", tolerance, err)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+/*
+Package glyphmesh builds meshes for rendering truetype glyphs with the technique
+described in GPU Gems 3 Chapter 25 (Loop-Blinn).  Each glyph outline is
+triangulated with package cdt, and every vertex is tagged with a uv class that a
+shader uses to evaluate the quadratic curve segments at each pixel.
+*/
+package glyphmesh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+	"golang.org/x/image/font/sfnt"
+
+	"github.com/Mischanix/loopblinn/cdt"
+)
+
+// IndexFormat selects the width of the indices in a GlyphMesh.
+type IndexFormat int
+
+const (
+	// IndexAuto selects Index16 for meshes with few enough vertices to be
+	// addressed with 16 bits, and Index32 for everything else.
+	IndexAuto IndexFormat = iota
+	Index16
+	Index32
+)
+
+// Size returns the number of bytes used by a single index, or 0 for IndexAuto.
+func (f IndexFormat) Size() int {
+	switch f {
+	case Index16:
+		return 2
+	case Index32:
+		return 4
+	}
+	return 0
+}
+
+// resolve returns the concrete format to use for a mesh of numVerts vertices.
+func (f IndexFormat) resolve(numVerts int) (IndexFormat, error) {
+	switch f {
+	case IndexAuto:
+		if numVerts <= math.MaxUint16+1 {
+			return Index16, nil
+		}
+		return Index32, nil
+	case Index16:
+		if numVerts > math.MaxUint16+1 {
+			return f, ErrIndexOverflow
+		}
+	}
+	return f, nil
+}
+
+// ErrIndexOverflow is returned when a mesh configured for Index16 has more
+// vertices than 16-bit indices can address.
+var ErrIndexOverflow = errors.New("glyphmesh: too many vertices for 16-bit indices")
+
+// GlyphMesh is a triangle mesh for a single glyph.  Positions are in ems,
+// relative to the glyph origin.
+type GlyphMesh struct {
+	// x, y; u, v; ib
+	positions []float32
+	uvs       []int8
+	indices   []uint32
+	// format is always Index16 or Index32
+	format IndexFormat
+
+	advance float32
+	// xMin, yMin, xMax, yMax
+	bounds [4]float32
+
+	stats MeshStats
+}
+
+// MeshStats reports how a GlyphMesh was assembled.
+type MeshStats struct {
+	// Vertices is the number of vertices emitted for the triangles of the
+	// mesh, and WeldedVertices is the number left after merging those that
+	// share a position and uv class.
+	Vertices, WeldedVertices int
+	// PrunedTriangles is the number of exterior triangles left out by
+	// Mesher.PruneExterior.
+	PrunedTriangles int
+}
+
+// add adds the stats of another mesh to s.
+func (s *MeshStats) add(other MeshStats) {
+	s.Vertices += other.Vertices
+	s.WeldedVertices += other.WeldedVertices
+	s.PrunedTriangles += other.PrunedTriangles
+}
+
+// Advance returns the distance from the origin of the glyph to the origin of
+// the next glyph on the line, in ems.
+func (m *GlyphMesh) Advance() float32 {
+	return m.advance
+}
+
+// Bounds returns the bounding box of the glyph's outline, in ems.  The mesh
+// itself may extend slightly beyond these bounds.
+func (m *GlyphMesh) Bounds() (xMin, yMin, xMax, yMax float32) {
+	return m.bounds[0], m.bounds[1], m.bounds[2], m.bounds[3]
+}
+
+// Stats returns how the mesh was assembled.  The stats of a mesh made by
+// Layout are the totals for its glyphs, and meshes decoded from a Bundle have
+// no stats.
+func (m *GlyphMesh) Stats() MeshStats {
+	return m.stats
+}
+
+// Positions returns the x, y pairs of every vertex in the mesh.
+func (m *GlyphMesh) Positions() []float32 {
+	return m.positions
+}
+
+// UVs returns the uv class of every vertex in the mesh.
+func (m *GlyphMesh) UVs() []int8 {
+	return m.uvs
+}
+
+// Indices returns the vertex indices of the mesh triangles.
+func (m *GlyphMesh) Indices() []uint32 {
+	return m.indices
+}
+
+// IndexFormat returns the index width chosen for the mesh, which is either
+// Index16 or Index32.  Renderers and exporters should store the indices with
+// this width.
+func (m *GlyphMesh) IndexFormat() IndexFormat {
+	return m.format
+}
+
+// Indices16 returns a copy of the mesh indices narrowed to 16 bits.  It returns
+// nil if the mesh's IndexFormat is Index32.
+func (m *GlyphMesh) Indices16() []uint16 {
+	if m.format != Index16 {
+		return nil
+	}
+	indices := make([]uint16, len(m.indices))
+	for i, idx := range m.indices {
+		indices[i] = uint16(idx)
+	}
+	return indices
+}
+
+// The uv classes assigned to each vertex.  The shader maps these to the
+// texture coordinates of the quadratic u^2 - v, with a third coordinate that
+// selects which side of the curve is filled.
+const (
+	UVBeginConvex = iota
+	UVMidConvex
+	UVEndConvex
+	UVBeginConcave
+	UVMidConcave
+	UVEndConcave
+	UVExterior
+	UVInterior
+)
+
+// A Mesher builds GlyphMeshes for the glyphs of a font.  A Mesher reuses its
+// glyph buffer between calls, so it must not be used from multiple goroutines
+// at once.
+type Mesher struct {
+	// IndexFormat selects the index width of the meshes produced; the default,
+	// IndexAuto, picks the narrowest format that fits each mesh.
+	IndexFormat IndexFormat
+	// Cache, if set, is consulted before meshing a glyph and is filled with
+	// each glyph meshed.  Meshes returned from the cache are shared, so they
+	// must not be modified.
+	Cache *Cache
+	// PruneExterior leaves the exterior filler triangles out of the meshes
+	// produced, leaving only the interior triangles and the curve hulls.  The
+	// shaders give exterior triangles zero alpha, so they never show, even at
+	// antialiased edges, which the triangles inside the outline shade
+	// themselves.
+	PruneExterior bool
+	// CubicTolerance is how far, in ems, the quadratic curves that replace
+	// the cubic curves of CFF outlines may stray from them; 0 selects
+	// DefaultCubicTolerance, and a negative tolerance is an error.
+	CubicTolerance float32
+
+	// font is the font being meshed, for the Cache to tell fonts apart.
+	font interface{}
+	src  glyphSource
+}
+
+// NewMesher returns a Mesher for the glyphs of font.
+func NewMesher(font *truetype.Font) *Mesher {
+	return &Mesher{
+		font: font,
+		src:  &trueTypeSource{font, truetype.NewGlyphBuf()},
+	}
+}
+
+// NewSFNTMesher returns a Mesher for the glyphs of an OpenType font parsed by
+// package sfnt.  Unlike package truetype, sfnt reads CFF outlines, whose cubic
+// curves the Mesher converts to quadratics.
+func NewSFNTMesher(font *sfnt.Font) *Mesher {
+	return &Mesher{
+		font: font,
+		src:  newSFNTSource(font),
+	}
+}
+
+// Index returns the index of the glyph for r in the Mesher's font, or 0 if the
+// font has no glyph for r.
+func (m *Mesher) Index(r rune) truetype.Index {
+	return m.src.index(r)
+}
+
+// cubicTolerance returns the tolerance for converting cubic curves.
+func (m *Mesher) cubicTolerance() float32 {
+	if m.CubicTolerance == 0 {
+		return DefaultCubicTolerance
+	}
+	return m.CubicTolerance
+}
+
+// load loads a glyph from the Mesher's font, with cubic curves converted to
+// quadratics within the Mesher's tolerance.
+func (m *Mesher) load(index truetype.Index) (*Outline, float32, [4]float32, error) {
+	if !(m.cubicTolerance() > 0) {
+		return nil, 0, [4]float32{}, ErrCubicTolerance
+	}
+	return m.src.load(index, m.cubicTolerance())
+}
+
+// Mesh loads the glyph for r and builds its Loop-Blinn mesh.  Errors from
+// loading the glyph and from package cdt are returned wrapped with the rune
+// that failed.
+func (m *Mesher) Mesh(r rune) (*GlyphMesh, error) {
+	mesh, err := m.cachedMesh(m.src.index(r))
+	if err != nil {
+		return nil, fmt.Errorf("glyphmesh: meshing %q: %w", r, err)
+	}
+	return mesh, nil
+}
+
+// MeshIndex is like Mesh, but takes the index of the glyph within the font
+// rather than a rune.
+func (m *Mesher) MeshIndex(index truetype.Index) (*GlyphMesh, error) {
+	mesh, err := m.cachedMesh(index)
+	if err != nil {
+		return nil, fmt.Errorf("glyphmesh: meshing glyph %d: %w", index, err)
+	}
+	return mesh, nil
+}
+
+func (m *Mesher) cachedMesh(index truetype.Index) (*GlyphMesh, error) {
+	if m.Cache == nil {
+		return m.mesh(index)
+	}
+	key := cacheKey{m.font, index, m.IndexFormat, m.PruneExterior, m.cubicTolerance()}
+	if mesh := m.Cache.get(key); mesh != nil {
+		return mesh, nil
+	}
+	mesh, err := m.mesh(index)
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.put(key, mesh)
+	return mesh, nil
+}
+
+func (m *Mesher) mesh(index truetype.Index) (*GlyphMesh, error) {
+	outline, advance, bounds, err := m.load(index)
+	if err != nil {
+		return nil, fmt.Errorf("loading: %w", err)
+	}
+
+	// preprocessing
+	outline.subdivideOverlaps()
+
+	// Triangulation!
+	// define points and bezier triangles:
+	glyphMesh := &GlyphMesh{advance: advance, bounds: bounds}
+	positions := make([]float32, 0)
+	uvs := make([]int8, 0)
+	indices := make([]int32, 0)
+	lines := []int32{}
+	addVert := func(p mgl32.Vec2, uv int8) int32 {
+		positions = append(positions, p[0], p[1])
+		uvs = append(uvs, uv)
+		return int32(len(uvs) - 1)
+	}
+	for _, c := range outline.Contours {
+		// every segment starts with a vertex of its own, and lines run between
+		// them:
+		firstI := int32(len(uvs))
+		for i, s := range c {
+			begin := addVert(s.P0, UVBeginConvex)
+			if s.Line {
+				next := begin + 1
+				if i == len(c)-1 {
+					next = firstI
+				}
+				lines = append(lines, begin, next)
+				continue
+			}
+			indices = append(indices,
+				begin, addVert(s.P1, UVMidConvex), addVert(s.P2, UVEndConvex))
+		}
+	}
+
+	// tessellate the glyph with CDT, following the contours so that the
+	// triangles between them can be filled by winding number:
+	edges := []int32{}
+	for i := 0; i < len(indices); i += 3 {
+		// the chord runs both ways, so that it bounds nothing, and the control
+		// point decides the winding inside the spline triangle:
+		edges = append(edges,
+			indices[i+0], indices[i+1],
+			indices[i+1], indices[i+2],
+			indices[i+2], indices[i+0],
+			indices[i+0], indices[i+2])
+	}
+	edges = append(edges, lines...)
+	// the triangles around the corners of the bounding rectangle would only
+	// be filler outside the glyph:
+	tVerts, srcToDtIs, interior, exterior, err := cdt.TriangulateFill(
+		positions, edges, cdt.NonZero, false)
+	if err != nil {
+		return nil, fmt.Errorf("triangulating: %w", err)
+	}
+	tTris := append(interior, exterior...)
+
+	// to build final mesh:
+	// iterate over indices, looking up the corresponding triangles in tTris by
+	// their vertices
+	// insert those triangles with the appropriate uvs as given by uvs, and mark
+	// them as inserted against tTris
+	// then, iterate over tTris, for all not-yet-inserted triangles: if the
+	// triangle is in the interior, the triangle uvs should be [0 1], otherwise
+	// the triangle uvs should be [1 0]
+	// finally, weld the vertices that the triangles share.
+	triangleAt := make(map[[3]int32]int, len(tTris)/3)
+	for j := 0; j < len(tTris); j += 3 {
+		triangleAt[triangleKey(tTris[j], tTris[j+1], tTris[j+2])] = j
+	}
+	isSpline := make([]bool, len(tTris)/3)
+	// built when a spline triangle isn't in tTris:
+	var triangleAcross map[[2]int32]int
+	var trianglesAround map[int32][]int
+	for i := 0; i < len(indices); i += 3 {
+		dtVIs := [3]int32{
+			srcToDtIs[int(indices[i])],
+			srcToDtIs[int(indices[i+1])],
+			srcToDtIs[int(indices[i+2])]}
+		srcIs := [3]int{}
+		concave := false
+		if triI, ok := triangleAt[triangleKey(dtVIs[0], dtVIs[1], dtVIs[2])]; ok {
+			isSpline[triI/3] = true
+			// tTris is clockwise, so the spline triangle is concave when its
+			// vertices run the other way:
+			for k := range srcIs {
+				for n, dtVI := range dtVIs {
+					if dtVI == tTris[triI+k] {
+						srcIs[k] = n
+					}
+				}
+			}
+			concave = (srcIs[0]+1)%3 != srcIs[1]
+		} else {
+			// a vertex or an edge split the spline triangle, so it's drawn
+			// over the pieces instead.  This only happens where the outline
+			// overlaps itself:
+			ps := [3]mgl32.Vec2{}
+			for n, dtVI := range dtVIs {
+				ps[n] = mgl32.Vec2{tVerts[dtVI], tVerts[dtVI+1]}
+			}
+			area := edgeFunction(ps[0], ps[1], ps[2])
+			if area == 0 {
+				continue
+			}
+			concave = area > 0
+			srcIs = [3]int{0, 1, 2}
+			if concave {
+				srcIs = [3]int{0, 2, 1}
+			}
+			// the triangles that overlap the spline triangle are found by a
+			// flood fill from those around its vertices, and the ones mostly
+			// inside it are left to it:
+			if triangleAcross == nil {
+				triangleAcross, trianglesAround = triangleAdjacency(tTris)
+			}
+			hull := Segment{ps[0], ps[1], ps[2], false}
+			stack := []int{}
+			for _, dtVI := range dtVIs {
+				stack = append(stack, trianglesAround[dtVI]...)
+			}
+			seen := map[int]bool{}
+			for len(stack) > 0 {
+				j := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if seen[j] {
+					continue
+				}
+				seen[j] = true
+				qs := [3]mgl32.Vec2{}
+				for k := range qs {
+					qs[k] = mgl32.Vec2{tVerts[tTris[j+k]], tVerts[tTris[j+k]+1]}
+				}
+				if !hullsOverlap(hull, Segment{qs[0], qs[1], qs[2], false}) {
+					continue
+				}
+				mp := qs[0].Add(qs[1]).Add(qs[2]).Mul(float32(1) / float32(3))
+				inside := true
+				for k := 0; k < 3; k++ {
+					if edgeFunction(ps[srcIs[k]], ps[srcIs[(k+1)%3]], mp) >= 0 {
+						inside = false
+					}
+				}
+				if inside {
+					isSpline[j/3] = true
+				}
+				for k := 0; k < 3; k++ {
+					twin := [2]int32{tTris[j+(k+1)%3], tTris[j+k]}
+					if n, ok := triangleAcross[twin]; ok {
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		for _, n := range srcIs {
+			idx := int(indices[i+n])
+			dtVIn := srcToDtIs[idx]
+			uv := uvs[idx]
+			if concave {
+				uv += 3
+			}
+			pos := mgl32.Vec2{tVerts[dtVIn], tVerts[dtVIn+1]}
+			dstVertI := len(glyphMesh.positions) / 2
+			glyphMesh.positions = append(glyphMesh.positions, pos[0], pos[1])
+			glyphMesh.uvs = append(glyphMesh.uvs, uv)
+			glyphMesh.indices = append(glyphMesh.indices, uint32(dstVertI))
+		}
+	}
+	for i := 0; i < len(tTris); i += 3 {
+		if isSpline[i/3] {
+			continue
+		}
+		p0 := mgl32.Vec2{tVerts[tTris[i]], tVerts[tTris[i]+1]}
+		p1 := mgl32.Vec2{tVerts[tTris[i+1]], tVerts[tTris[i+1]+1]}
+		p2 := mgl32.Vec2{tVerts[tTris[i+2]], tVerts[tTris[i+2]+1]}
+		uv := int8(UVExterior)
+		if i < len(interior) {
+			uv = UVInterior
+		} else if m.PruneExterior {
+			glyphMesh.stats.PrunedTriangles++
+			continue
+		}
+		ps := []mgl32.Vec2{p0, p1, p2}
+		for _, p := range ps {
+			dstVertI := len(glyphMesh.positions) / 2
+			glyphMesh.positions = append(glyphMesh.positions, p[0], p[1])
+			glyphMesh.uvs = append(glyphMesh.uvs, uv)
+			glyphMesh.indices = append(glyphMesh.indices, uint32(dstVertI))
+		}
+	}
+	glyphMesh.weld()
+	glyphMesh.format, err = m.IndexFormat.resolve(len(glyphMesh.uvs))
+	if err != nil {
+		return nil, err
+	}
+	return glyphMesh, nil
+}
+
+// weldQuantum is the spacing of the grid that weld rounds positions to, in
+// ems.  It's far finer than any rendering, but coarse enough to merge the
+// copies of a point computed by different paths.
+const weldQuantum = 1.0 / (1 << 20)
+
+// weld merges the vertices of m with the same uv class whose positions round
+// to the same point of a grid of spacing weldQuantum, keeping the first of
+// each, and records the vertex counts before and after in m's stats.
+func (m *GlyphMesh) weld() {
+	type weldKey struct {
+		x, y int64
+		uv   int8
+	}
+	numVerts := len(m.uvs)
+	welded := make(map[weldKey]uint32, numVerts)
+	dstVertIs := make([]uint32, numVerts)
+	n := 0
+	for v := 0; v < numVerts; v++ {
+		key := weldKey{
+			int64(math.Round(float64(m.positions[2*v]) / weldQuantum)),
+			int64(math.Round(float64(m.positions[2*v+1]) / weldQuantum)),
+			m.uvs[v]}
+		dstVertI, ok := welded[key]
+		if !ok {
+			dstVertI = uint32(n)
+			welded[key] = dstVertI
+			m.positions[2*n], m.positions[2*n+1] = m.positions[2*v], m.positions[2*v+1]
+			m.uvs[n] = m.uvs[v]
+			n++
+		}
+		dstVertIs[v] = dstVertI
+	}
+	m.positions = m.positions[:2*n]
+	m.uvs = m.uvs[:n]
+	for i, idx := range m.indices {
+		m.indices[i] = dstVertIs[idx]
+	}
+	m.stats.Vertices = numVerts
+	m.stats.WeldedVertices = n
+}
+
+// triangleAdjacency returns, for the flat list of vertex triples tris, the
+// index in tris of the triangle with each edge, keyed by the edge's vertices in
+// the triangle's order, and the indices of the triangles around each vertex.
+func triangleAdjacency(tris []int32) (across map[[2]int32]int, around map[int32][]int) {
+	across = make(map[[2]int32]int, len(tris))
+	around = make(map[int32][]int, len(tris)/2)
+	for j := 0; j < len(tris); j += 3 {
+		for k := 0; k < 3; k++ {
+			across[[2]int32{tris[j+k], tris[j+(k+1)%3]}] = j
+			around[tris[j+k]] = append(around[tris[j+k]], j)
+		}
+	}
+	return across, around
+}
+
+// triangleKey returns the vertices of a triangle in a canonical order, to
+// look it up by.
+func triangleKey(a, b, c int32) [3]int32 {
+	if a > b {
+		a, b = b, a
+	}
+	if b > c {
+		b, c = c, b
+	}
+	if a > b {
+		a, b = b, a
+	}
+	return [3]int32{a, b, c}
+}
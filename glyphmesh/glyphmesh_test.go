@@ -0,0 +1,191 @@
+package glyphmesh
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// testRunes are the runes in testdata/testfont.ttf.
+const testRunes = "&@0123456789AQRSWacghimorsy께"
+
+func loadTestFont(t testing.TB) *truetype.Font {
+	buf, err := ioutil.ReadFile("testdata/testfont.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := truetype.Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+func TestIndexFormatResolve(t *testing.T) {
+	for _, test := range []struct {
+		format   IndexFormat
+		numVerts int
+		want     IndexFormat
+		err      error
+	}{
+		{IndexAuto, 3, Index16, nil},
+		{IndexAuto, math.MaxUint16 + 1, Index16, nil},
+		{IndexAuto, math.MaxUint16 + 2, Index32, nil},
+		{Index16, math.MaxUint16 + 1, Index16, nil},
+		{Index16, math.MaxUint16 + 2, Index16, ErrIndexOverflow},
+		{Index32, 3, Index32, nil},
+		{Index32, math.MaxUint16 + 2, Index32, nil},
+	} {
+		got, err := test.format.resolve(test.numVerts)
+		if got != test.want || err != test.err {
+			t.Errorf("%v with %d vertices resolved to %v, %v, want %v, %v",
+				test.format, test.numVerts, got, err, test.want, test.err)
+		}
+	}
+	for format, size := range map[IndexFormat]int{IndexAuto: 0, Index16: 2, Index32: 4} {
+		if got := format.Size(); got != size {
+			t.Errorf("%v has size %d, want %d", format, got, size)
+		}
+	}
+}
+
+func TestIndexFormat(t *testing.T) {
+	font := loadTestFont(t)
+	for _, format := range []IndexFormat{IndexAuto, Index16, Index32} {
+		mesher := NewMesher(font)
+		mesher.IndexFormat = format
+		m, err := mesher.Mesh('g')
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := format
+		if want == IndexAuto {
+			want = Index16
+		}
+		if m.IndexFormat() != want {
+			t.Errorf("%v: the mesh's format is %v, want %v", format, m.IndexFormat(), want)
+		}
+		indices16 := m.Indices16()
+		if want == Index32 {
+			if indices16 != nil {
+				t.Errorf("%v: Indices16 isn't nil", format)
+			}
+			continue
+		}
+		if len(indices16) != len(m.Indices()) {
+			t.Fatalf("%v: %d 16-bit indices, want %d", format, len(indices16), len(m.Indices()))
+		}
+		for i, index := range m.Indices() {
+			if uint32(indices16[i]) != index {
+				t.Errorf("%v: 16-bit index %d is %d, want %d", format, i, indices16[i], index)
+				break
+			}
+		}
+	}
+}
+
+// outlineSource is a glyphSource with a single glyph, o.
+type outlineSource struct {
+	o *Outline
+}
+
+func (s outlineSource) index(r rune) truetype.Index {
+	return 1
+}
+
+func (s outlineSource) load(index truetype.Index, tolerance float32) (*Outline,
+	float32, [4]float32, error) {
+
+	// the Mesher changes the outline it's given:
+	o := &Outline{}
+	for _, c := range s.o.Contours {
+		o.Contours = append(o.Contours, append(Contour(nil), c...))
+	}
+	return o, 1, [4]float32{0, 0, 1, 1}, nil
+}
+
+func (s outlineSource) kerning(a, b truetype.Index) float32 {
+	return 0
+}
+
+func TestWeld(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	for _, r := range "&@ASWcgors께" {
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := m.Stats()
+		if stats.Vertices != len(m.Indices()) {
+			t.Errorf("%q: %d vertices before welding, want one per index, %d",
+				r, stats.Vertices, len(m.Indices()))
+		}
+		if stats.WeldedVertices != len(m.UVs()) || stats.WeldedVertices >= stats.Vertices {
+			t.Errorf("%q: welded %d vertices to %d, and the mesh has %d",
+				r, stats.Vertices, stats.WeldedVertices, len(m.UVs()))
+		}
+		type vertex struct {
+			x, y float32
+			uv   int8
+		}
+		seen := map[vertex]int{}
+		for v, uv := range m.UVs() {
+			key := vertex{m.Positions()[2*v], m.Positions()[2*v+1], uv}
+			if w, ok := seen[key]; ok {
+				t.Errorf("%q: vertices %d and %d are both %v", r, w, v, key)
+			}
+			seen[key] = v
+		}
+	}
+}
+
+func TestCrossedSplineTriangles(t *testing.T) {
+	// a short line just above a curve, inside the control triangle of the
+	// piece of the curve below it however finely the curve is subdivided,
+	// run there and back so that it bounds nothing:
+	curve := Segment{mgl32.Vec2{0, 0}, mgl32.Vec2{1, 2}, mgl32.Vec2{2, 0}, false}
+	line := Segment{mgl32.Vec2{2, 0}, mgl32.Vec2{1, 0}, mgl32.Vec2{0, 0}, true}
+	p := curve.point(0.5078125).Add(mgl32.Vec2{0, 0.0001})
+	q := p.Add(mgl32.Vec2{0.00001, 0})
+	mark := Contour{
+		{p, p.Add(q).Mul(0.5), q, true},
+		{q, p.Add(q).Mul(0.5), p, true},
+	}
+	mesher := &Mesher{src: outlineSource{&Outline{Contours: []Contour{{curve, line}, mark}}}}
+	m, err := mesher.Mesh('a')
+	if err != nil {
+		t.Fatal(err)
+	}
+	triangle := func(i int) (ps [3]mgl32.Vec2, spline bool) {
+		for j, idx := range m.Indices()[i : i+3] {
+			ps[j] = mgl32.Vec2{m.Positions()[2*idx], m.Positions()[2*idx+1]}
+			spline = m.UVs()[idx] < UVExterior
+		}
+		return ps, spline
+	}
+	// the spline triangles are drawn over the triangles that split them,
+	// which mustn't also be drawn as filler:
+	for i := 0; i < len(m.Indices()); i += 3 {
+		ps, spline := triangle(i)
+		if spline {
+			continue
+		}
+		mp := ps[0].Add(ps[1]).Add(ps[2]).Mul(float32(1) / 3)
+		for j := 0; j < len(m.Indices()); j += 3 {
+			qs, spline := triangle(j)
+			if !spline {
+				continue
+			}
+			a := edgeFunction(qs[0], qs[1], mp)
+			b := edgeFunction(qs[1], qs[2], mp)
+			c := edgeFunction(qs[2], qs[0], mp)
+			if a > 0 && b > 0 && c > 0 || a < 0 && b < 0 && c < 0 {
+				t.Errorf("filler triangle %v is inside spline triangle %v", ps, qs)
+			}
+		}
+	}
+}
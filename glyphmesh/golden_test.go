@@ -0,0 +1,146 @@
+package glyphmesh
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the renders to testdata/golden instead of comparing")
+
+const (
+	// goldenScale is the size of an em in pixels.
+	goldenScale = 64
+	// goldenPadding is the number of pixels left around each glyph.
+	goldenPadding = 2
+	// goldenSamples is the multisampling used, as in the demo.
+	goldenSamples = 8
+	// goldenTolerance is how far a pixel may stray from the golden, to allow
+	// for floating point differences between platforms.
+	goldenTolerance = 2
+)
+
+// renderGolden renders m, with the pixel grid aligned to its origin.
+func renderGolden(m *GlyphMesh) *image.Alpha {
+	xMin, yMin, xMax, yMax := m.Bounds()
+	x0 := float32(math.Floor(float64(xMin*goldenScale))) - goldenPadding
+	y0 := float32(math.Floor(float64(yMin*goldenScale))) - goldenPadding
+	x1 := float32(math.Ceil(float64(xMax*goldenScale))) + goldenPadding
+	y1 := float32(math.Ceil(float64(yMax*goldenScale))) + goldenPadding
+	width, height := int(x1-x0), int(y1-y0)
+	img := image.NewAlpha(image.Rect(0, 0, width, height))
+	transform := ViewTransform(
+		x0/goldenScale, y0/goldenScale, x1/goldenScale, y1/goldenScale, width, height)
+	Rasterize(img, m, transform, goldenSamples)
+	return img
+}
+
+// checkGolden compares img against testdata/golden/name.png, or replaces the
+// golden with it when -update is given.
+func checkGolden(t *testing.T, name string, img *image.Alpha) {
+	path := filepath.Join("testdata", "golden", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -update to create it", err)
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("rendered %v, golden is %v", img.Bounds(), golden.Bounds())
+	}
+	bad, worst := 0, 0
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			_, _, _, a := golden.At(x, y).RGBA()
+			d := int(img.AlphaAt(x, y).A) - int(a>>8)
+			if d < 0 {
+				d = -d
+			}
+			if d > goldenTolerance {
+				bad++
+			}
+			worst = max(worst, d)
+		}
+	}
+	if bad > 0 {
+		t.Errorf("%d pixels differ from %s by more than %d, by up to %d",
+			bad, path, goldenTolerance, worst)
+	}
+}
+
+func TestGoldenGlyphs(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	for _, r := range testRunes {
+		t.Run(fmt.Sprintf("%U", r), func(t *testing.T) {
+			m, err := mesher.Mesh(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, fmt.Sprintf("%U", r), renderGolden(m))
+		})
+	}
+}
+
+func TestGoldenLayout(t *testing.T) {
+	m, err := LayoutString(loadTestFont(t), "chgrRo34께", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "layout", renderGolden(m))
+}
+
+func TestPruneExterior(t *testing.T) {
+	font := loadTestFont(t)
+	mesher := NewMesher(font)
+	pruner := NewMesher(font)
+	pruner.PruneExterior = true
+	for _, r := range testRunes {
+		full, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pruned, err := pruner.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, uv := range pruned.UVs() {
+			if uv == UVExterior {
+				t.Errorf("%q: pruned mesh has exterior vertices", r)
+				break
+			}
+		}
+		numPruned := (len(full.Indices()) - len(pruned.Indices())) / 3
+		if stats := pruned.Stats(); numPruned == 0 || stats.PrunedTriangles != numPruned {
+			t.Errorf("%q: %d triangles pruned, stats report %d", r, numPruned, stats.PrunedTriangles)
+		}
+		// the exterior triangles never show:
+		want, got := renderGolden(full), renderGolden(pruned)
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("%q: pruning the exterior changed the render", r)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package glyphmesh
+
+import (
+	"fmt"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// LayoutString meshes text in font along a single line and merges the glyphs
+// in to one GlyphMesh, so that the whole line can be drawn with one draw call.
+// size is the height of an em in the units of the returned mesh.
+func LayoutString(font *truetype.Font, text string, size float32) (*GlyphMesh, error) {
+	return NewMesher(font).Layout(text, size)
+}
+
+// Layout meshes text along a single line and merges the glyphs in to one
+// GlyphMesh.  Glyphs are placed using the font's advance widths and kerning,
+// starting with the origin of the first glyph at 0, 0.  size is the height of
+// an em in the units of the returned mesh.  The Advance of the result is that
+// of the whole line, and its Bounds cover the glyphs that have any triangles,
+// so that blank glyphs such as spaces don't widen them.
+func (m *Mesher) Layout(text string, size float32) (*GlyphMesh, error) {
+	result := &GlyphMesh{}
+	x := float32(0)
+	prev := truetype.Index(0)
+	inked := false
+	for i, r := range text {
+		idx := m.src.index(r)
+		if i > 0 {
+			x += m.src.kerning(prev, idx)
+		}
+		glyph, err := m.MeshIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+		result.appendMesh(glyph, size, x*size, 0)
+		// a blank glyph's bounds are empty, at its origin:
+		if len(glyph.indices) > 0 {
+			gxMin, gyMin, gxMax, gyMax := glyph.Bounds()
+			if !inked {
+				result.bounds = [4]float32{
+					(x + gxMin) * size, gyMin * size, (x + gxMax) * size, gyMax * size}
+			} else {
+				result.bounds = [4]float32{
+					min(result.bounds[0], (x+gxMin)*size),
+					min(result.bounds[1], gyMin*size),
+					max(result.bounds[2], (x+gxMax)*size),
+					max(result.bounds[3], gyMax*size)}
+			}
+			inked = true
+		}
+		x += glyph.Advance()
+		prev = idx
+	}
+	result.advance = x * size
+	var err error
+	result.format, err = m.IndexFormat.resolve(len(result.uvs))
+	if err != nil {
+		return nil, fmt.Errorf("glyphmesh: laying out %q: %w", text, err)
+	}
+	return result, nil
+}
+
+// appendMesh appends the triangles of src to m.  The positions of src are
+// scaled by scale and then offset by dx, dy.
+func (m *GlyphMesh) appendMesh(src *GlyphMesh, scale, dx, dy float32) {
+	base := uint32(len(m.uvs))
+	for i := 0; i < len(src.positions); i += 2 {
+		m.positions = append(m.positions,
+			src.positions[i]*scale+dx, src.positions[i+1]*scale+dy)
+	}
+	m.uvs = append(m.uvs, src.uvs...)
+	for _, idx := range src.indices {
+		m.indices = append(m.indices, base+idx)
+	}
+	m.stats.add(src.stats)
+}
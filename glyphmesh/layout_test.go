@@ -0,0 +1,77 @@
+package glyphmesh
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLayoutBounds(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	layout := func(text string) *GlyphMesh {
+		m, err := mesher.Layout(text, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	o := layout("o")
+	space := layout(" ")
+	if len(space.Indices()) != 0 || space.Advance() == 0 {
+		t.Fatalf("' ' isn't a blank glyph with an advance")
+	}
+	if got := [4]float32{}; space.bounds != got {
+		t.Errorf("a line of only spaces has bounds %v, want %v", space.bounds, got)
+	}
+	// spaces at either end of the line move the ink, but don't stretch its
+	// bounds:
+	shift := space.Advance() + 2*mesher.src.kerning(mesher.Index(' '), mesher.Index('o'))
+	for _, test := range []struct {
+		text string
+		dx   float32
+	}{
+		{"o ", 0},
+		{"o  ", 0},
+		{" o", shift},
+		{" o ", shift},
+	} {
+		want := o.bounds
+		want[0] += test.dx
+		want[2] += test.dx
+		if got := layout(test.text).bounds; got != want {
+			t.Errorf("%q has bounds %v, want %v", test.text, got, want)
+		}
+	}
+}
+
+func TestLayoutIndexOverflow(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	glyph, err := mesher.Mesh('@')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// just enough glyphs to need more than 16-bit indices:
+	text := strings.Repeat("@", (math.MaxUint16+1)/len(glyph.UVs())+1)
+
+	m, err := mesher.Layout(text, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.UVs()) <= math.MaxUint16+1 || m.IndexFormat() != Index32 || m.Indices16() != nil {
+		t.Errorf("IndexAuto laid out %d vertices with format %v", len(m.UVs()), m.IndexFormat())
+	}
+
+	mesher.IndexFormat = Index16
+	if _, err := mesher.Layout(text, 1); !errors.Is(err, ErrIndexOverflow) {
+		t.Errorf("Index16 laid out %d vertices: got %v, want ErrIndexOverflow", len(m.UVs()), err)
+	}
+	// one glyph fewer fits:
+	m, err = mesher.Layout(text[1:], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.IndexFormat() != Index16 || len(m.Indices16()) != len(m.Indices()) {
+		t.Errorf("Index16 laid out %d vertices with format %v", len(m.UVs()), m.IndexFormat())
+	}
+}
@@ -0,0 +1,229 @@
+package glyphmesh
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// An Outline is the shape of a glyph as closed contours of lines and quadratic
+// curves, in ems relative to the glyph origin.
+type Outline struct {
+	Contours []Contour
+}
+
+// A Contour is a closed path; each segment starts where the previous one
+// ended, and the last segment ends where the first one starts.
+type Contour []Segment
+
+// A Segment is a quadratic Bézier curve from P0 to P2 with the control point
+// P1.  Lines are stored with Line set and P1 halfway between P0 and P2, so
+// every segment can also be treated as a curve.
+type Segment struct {
+	P0, P1, P2 mgl32.Vec2
+	Line       bool
+}
+
+// Outline loads the outline of the glyph for r.
+func (m *Mesher) Outline(r rune) (*Outline, error) {
+	o, err := m.outline(m.src.index(r))
+	if err != nil {
+		return nil, fmt.Errorf("glyphmesh: loading %q: %w", r, err)
+	}
+	return o, nil
+}
+
+// OutlineIndex is like Outline, but takes the index of the glyph within the
+// font rather than a rune.
+func (m *Mesher) OutlineIndex(index truetype.Index) (*Outline, error) {
+	o, err := m.outline(index)
+	if err != nil {
+		return nil, fmt.Errorf("glyphmesh: loading glyph %d: %w", index, err)
+	}
+	return o, nil
+}
+
+func (m *Mesher) outline(index truetype.Index) (*Outline, error) {
+	o, _, _, err := m.load(index)
+	return o, err
+}
+
+// outlineFromGlyph converts the points of a loaded glyph to an Outline,
+// inserting the on-curve points implied between consecutive off-curve points.
+func outlineFromGlyph(glyph *truetype.GlyphBuf) *Outline {
+	type point struct {
+		p  mgl32.Vec2
+		on bool
+	}
+	o := &Outline{}
+	start := 0
+	for _, end := range glyph.End {
+		pts := make([]point, 0, end-start)
+		first := -1
+		for i, p := range glyph.Point[start:end] {
+			on := p.Flags&1 != 0
+			if on && first < 0 {
+				first = i
+			}
+			pts = append(pts, point{
+				mgl32.Vec2{float32(p.X) / 65536, float32(p.Y) / 65536}, on})
+		}
+		start = end
+		if len(pts) < 2 {
+			continue
+		}
+		if first < 0 {
+			// every point is off the curve, so start from an implied point:
+			mid := pts[0].p.Add(pts[len(pts)-1].p).Mul(0.5)
+			pts = append([]point{{mid, true}}, pts...)
+			first = 0
+		}
+		pts = append(pts[first:], pts[:first]...)
+		pts = append(pts, pts[0])
+
+		var c Contour
+		p0 := pts[0].p
+		for i := 1; i < len(pts); i++ {
+			pt := pts[i]
+			if pt.on {
+				if pt.p != p0 {
+					c = append(c, Segment{p0, p0.Add(pt.p).Mul(0.5), pt.p, true})
+				}
+				p0 = pt.p
+				continue
+			}
+			next := pts[i+1]
+			p2 := next.p
+			if !next.on {
+				p2 = pt.p.Add(next.p).Mul(0.5)
+			} else {
+				i++
+			}
+			c = append(c, Segment{p0, pt.p, p2, false})
+			p0 = p2
+		}
+		if len(c) > 0 {
+			o.Contours = append(o.Contours, c)
+		}
+	}
+	return o
+}
+
+// Winding returns the winding number of the outline around p.  TrueType outer
+// contours run clockwise, so points inside the glyph have a negative winding
+// number; with the nonzero rule, p is inside when the result isn't 0.
+func (o *Outline) Winding(p mgl32.Vec2) int {
+	w := 0
+	for _, c := range o.Contours {
+		for _, s := range c {
+			w += s.winding(p)
+		}
+	}
+	return w
+}
+
+// winding returns the contribution of s to the winding number around p: the
+// signed number of times s crosses the ray from p towards +x, counting
+// upwards crossings as +1.  Each y-monotonic piece of s covers the half-open
+// range of y from its lower end, so that crossings at the joins between
+// segments are counted once.
+func (s Segment) winding(p mgl32.Vec2) int {
+	x0, y0 := float64(s.P0[0]), float64(s.P0[1])
+	x1, y1 := float64(s.P1[0]), float64(s.P1[1])
+	x2, y2 := float64(s.P2[0]), float64(s.P2[1])
+	px, py := float64(p[0]), float64(p[1])
+	// quick reject on the hull of the control points:
+	if py < math.Min(y0, math.Min(y1, y2)) || py >= math.Max(y0, math.Max(y1, y2)) ||
+		px > math.Max(x0, math.Max(x1, x2)) {
+		return 0
+	}
+
+	ay := y0 - 2*y1 + y2
+	by := 2 * (y1 - y0)
+	ax := x0 - 2*x1 + x2
+	bx := 2 * (x1 - x0)
+	// split at the extremum of y, if it's inside the curve:
+	ts := [3]float64{0, 1, 1}
+	n := 2
+	if ay != 0 {
+		if t := -by / (2 * ay); t > 0 && t < 1 {
+			ts[1] = t
+			n = 3
+		}
+	}
+	w := 0
+	for i := 0; i+1 < n; i++ {
+		ta, tb := ts[i], ts[i+1]
+		ya := (ay*ta+by)*ta + y0
+		yb := (ay*tb+by)*tb + y0
+		dir := 1
+		lo, hi := ya, yb
+		if yb < ya {
+			dir = -1
+			lo, hi = yb, ya
+		}
+		if py < lo || py >= hi {
+			continue
+		}
+		// solve ay t^2 + by t + y0 - py = 0 for t within [ta, tb]:
+		t := solveMonotone(ay, by, y0-py, ta, tb)
+		if x := (ax*t+bx)*t + x0; x > px {
+			w += dir
+		}
+	}
+	return w
+}
+
+// solveMonotone returns the root of a t^2 + b t + c within [lo, hi], where the
+// quadratic is monotonic.
+func solveMonotone(a, b, c, lo, hi float64) float64 {
+	var t float64
+	if math.Abs(a) < 1e-12 {
+		t = -c / b
+	} else {
+		d := math.Sqrt(math.Max(b*b-4*a*c, 0))
+		// the numerically stable pair of roots:
+		q := -0.5 * (b + math.Copysign(d, b))
+		t = q / a
+		if q != 0 {
+			if t2 := c / q; t2 >= lo && t2 <= hi {
+				t = t2
+			}
+		}
+	}
+	return math.Max(lo, math.Min(hi, t))
+}
+
+// distance returns the approximate distance from p to s, measured to chords
+// of s that stray from it by no more than a quarter of validateTolerance.
+func (s Segment) distance(p mgl32.Vec2) float32 {
+	// chords across 1/steps of s stray from it by |P0 - 2 P1 + P2| / 4 steps^2:
+	bend := s.P0.Sub(s.P1.Mul(2)).Add(s.P2).Len()
+	steps := max(1, int(math.Ceil(math.Sqrt(float64(bend/validateTolerance)))))
+	d := float32(math.MaxFloat32)
+	prev := s.P0
+	for i := 1; i <= steps; i++ {
+		next := s.point(float32(i) / float32(steps))
+		d = min(d, segmentDistance(prev, next, p))
+		prev = next
+	}
+	return d
+}
+
+// point returns the point at t along s.
+func (s Segment) point(t float32) mgl32.Vec2 {
+	return s.P0.Mul((1 - t) * (1 - t)).Add(s.P1.Mul(2 * (1 - t) * t)).Add(s.P2.Mul(t * t))
+}
+
+// segmentDistance returns the distance from p to the line segment ab.
+func segmentDistance(a, b, p mgl32.Vec2) float32 {
+	ab := b.Sub(a)
+	t := float32(0)
+	if l := ab.Dot(ab); l > 0 {
+		t = mgl32.Clamp(p.Sub(a).Dot(ab)/l, 0, 1)
+	}
+	return p.Sub(a.Add(ab.Mul(t))).Len()
+}
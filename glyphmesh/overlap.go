@@ -0,0 +1,134 @@
+package glyphmesh
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// maxSubdivisions limits how many times subdivideOverlaps halves a curve,
+	// since a curve crossed by another contour, or meeting its neighbour at a
+	// sharp corner, overlaps it however small the pieces get.
+	maxSubdivisions = 6
+	// overlapTolerance is how far, in ems, triangles must reach in to each
+	// other to overlap, so that triangles touching along an edge or at a
+	// vertex don't overlap because of rounding.
+	overlapTolerance = 1e-9
+)
+
+// subdivideOverlaps splits the curves of o whose control triangles overlap
+// another control triangle or a line in two, with de Casteljau's algorithm,
+// until none overlap or the pieces have been split maxSubdivisions times.
+// Each half's control triangle lies inside the whole's, and hugs the curve
+// more closely, so the halves only overlap where the curves themselves come
+// close.  The mesh needs the triangles to be disjoint, since each is drawn
+// as a whole and must be a triangle of the triangulation.
+func (o *Outline) subdivideOverlaps() {
+	for pass := 0; pass < maxSubdivisions; pass++ {
+		type segmentRef struct {
+			contour, segment int
+			xMin, xMax       float32
+		}
+		var refs []segmentRef
+		for c, contour := range o.Contours {
+			for i, s := range contour {
+				refs = append(refs, segmentRef{c, i,
+					min(s.P0[0], s.P1[0], s.P2[0]), max(s.P0[0], s.P1[0], s.P2[0])})
+			}
+		}
+		// only segments whose bounds overlap in x need to be compared, and
+		// after sorting by xMin those come before the first that starts to
+		// the right:
+		sort.Slice(refs, func(i, j int) bool { return refs[i].xMin < refs[j].xMin })
+		split := make([][]bool, len(o.Contours))
+		for c, contour := range o.Contours {
+			split[c] = make([]bool, len(contour))
+		}
+		overlapping := false
+		for i, a := range refs {
+			sa := o.Contours[a.contour][a.segment]
+			for _, b := range refs[i+1:] {
+				if b.xMin >= a.xMax {
+					break
+				}
+				sb := o.Contours[b.contour][b.segment]
+				if sa.Line && sb.Line || !hullsOverlap(sa, sb) {
+					continue
+				}
+				split[a.contour][a.segment] = !sa.Line
+				split[b.contour][b.segment] = !sb.Line
+				overlapping = true
+			}
+		}
+		if !overlapping {
+			return
+		}
+		for c, contour := range o.Contours {
+			var halves Contour
+			for i, s := range contour {
+				if split[c][i] {
+					first, second := s.split()
+					halves = append(halves, first, second)
+				} else {
+					halves = append(halves, s)
+				}
+			}
+			o.Contours[c] = halves
+		}
+	}
+}
+
+// split returns the halves of s, from P0 to the point halfway along s and
+// from there to P2.
+func (s Segment) split() (Segment, Segment) {
+	p01 := s.P0.Add(s.P1).Mul(0.5)
+	p12 := s.P1.Add(s.P2).Mul(0.5)
+	mid := p01.Add(p12).Mul(0.5)
+	return Segment{s.P0, p01, mid, s.Line}, Segment{mid, p12, s.P2, s.Line}
+}
+
+// hull returns the control triangle of s, or its end points if s is a line.
+func (s Segment) hull() []mgl32.Vec2 {
+	if s.Line {
+		return []mgl32.Vec2{s.P0, s.P2}
+	}
+	return []mgl32.Vec2{s.P0, s.P1, s.P2}
+}
+
+// hullsOverlap reports whether the hulls of a and b reach in to each other by
+// more than overlapTolerance.  The hulls are convex, so they are disjoint
+// exactly when the projections of both on to the normal of one of their edges
+// are.
+func hullsOverlap(a, b Segment) bool {
+	ha, hb := a.hull(), b.hull()
+	for _, h := range [][]mgl32.Vec2{ha, hb} {
+		for i := range h {
+			p, q := h[i], h[(i+1)%len(h)]
+			nx, ny := -float64(q[1]-p[1]), float64(q[0]-p[0])
+			l := math.Hypot(nx, ny)
+			if l == 0 {
+				continue
+			}
+			nx, ny = nx/l, ny/l
+			aMin, aMax := project(ha, nx, ny)
+			bMin, bMax := project(hb, nx, ny)
+			if aMax <= bMin+overlapTolerance || bMax <= aMin+overlapTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// project returns the range of the projections of the points ps on to the
+// axis nx, ny.
+func project(ps []mgl32.Vec2, nx, ny float64) (lo, hi float64) {
+	lo, hi = math.Inf(1), math.Inf(-1)
+	for _, p := range ps {
+		d := float64(p[0])*nx + float64(p[1])*ny
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	return lo, hi
+}
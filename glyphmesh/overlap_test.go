@@ -0,0 +1,47 @@
+package glyphmesh
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestSubdivideOverlaps(t *testing.T) {
+	// a curve bulging over the corner of a square, whose control triangle
+	// holds the corner:
+	curve := Segment{mgl32.Vec2{0, 0}, mgl32.Vec2{1, 2}, mgl32.Vec2{2, 0}, false}
+	square := Contour{
+		{mgl32.Vec2{0.9, 0.2}, mgl32.Vec2{1.0, 0.2}, mgl32.Vec2{1.1, 0.2}, true},
+		{mgl32.Vec2{1.1, 0.2}, mgl32.Vec2{1.1, 0.5}, mgl32.Vec2{1.1, 0.8}, true},
+		{mgl32.Vec2{1.1, 0.8}, mgl32.Vec2{1.0, 0.8}, mgl32.Vec2{0.9, 0.8}, true},
+		{mgl32.Vec2{0.9, 0.8}, mgl32.Vec2{0.9, 0.5}, mgl32.Vec2{0.9, 0.2}, true},
+	}
+	line := Segment{mgl32.Vec2{2, 0}, mgl32.Vec2{1, 0}, mgl32.Vec2{0, 0}, true}
+	o := &Outline{Contours: []Contour{{curve, line}, square}}
+	o.subdivideOverlaps()
+
+	if got := len(o.Contours[1]); got != len(square) {
+		t.Errorf("the square has %d segments, want %d", got, len(square))
+	}
+	pieces := o.Contours[0][:len(o.Contours[0])-1]
+	if len(pieces) < 2 {
+		t.Fatalf("the curve wasn't split: %v", pieces)
+	}
+	for i, a := range pieces {
+		// the pieces run end to end along the curve:
+		if i > 0 && a.P0 != pieces[i-1].P2 {
+			t.Errorf("piece %d starts at %v, not where piece %d ends", i, a.P0, i-1)
+		}
+		mid := a.point(0.5)
+		if d := curve.distance(mid); d > 1e-5 {
+			t.Errorf("piece %d strays %v from the curve", i, d)
+		}
+		for _, c := range o.Contours {
+			for _, b := range c {
+				if b != a && hullsOverlap(a, b) {
+					t.Errorf("piece %d %v overlaps %v", i, a, b)
+				}
+			}
+		}
+	}
+}
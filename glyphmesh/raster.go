@@ -0,0 +1,183 @@
+package glyphmesh
+
+import (
+	"image"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// uvTexCoords maps each uv class to its texture coordinate; this must match
+// the table in the demo's vertexShader.
+var uvTexCoords = [8][3]float32{
+	{0.0, 0.0, 1.0},
+	{0.5, 0.0, 1.0},
+	{1.0, 1.0, 1.0},
+	{0.0, 0.0, 0.0},
+	{0.5, 0.0, 0.0},
+	{1.0, 1.0, 0.0},
+	{1.0, 0.0, 1.0},
+	{0.0, 1.0, 1.0},
+}
+
+// Sample offsets within a pixel, in 1/16ths of a pixel, for the multisample
+// patterns Rasterize supports.  These are the standard D3D patterns that most
+// GPUs use.
+var (
+	samplePattern1 = [][2]float32{{0, 0}}
+	samplePattern4 = [][2]float32{{-2, -6}, {6, -2}, {-6, 2}, {2, 6}}
+	samplePattern8 = [][2]float32{
+		{1, -3}, {-1, 3}, {5, 1}, {-3, -5}, {-5, 5}, {-7, -1}, {3, 7}, {7, -7}}
+)
+
+// ViewTransform returns the transform that maps the rectangle from xMin, yMin
+// to xMax, yMax in mesh coordinates on to an image of width by height pixels.
+// The y axis is flipped, since it points down in images.
+func ViewTransform(xMin, yMin, xMax, yMax float32, width, height int) mgl32.Mat3 {
+	sx := float32(width) / (xMax - xMin)
+	sy := float32(height) / (yMax - yMin)
+	return mgl32.Mat3{
+		sx, 0, 0,
+		0, -sy, 0,
+		-xMin * sx, yMax * sy, 1,
+	}
+}
+
+// Rasterize draws m in to dst, as the demo's shaders would with a black glyph
+// over a white background, with dst holding how dark each pixel is.  transform
+// maps mesh positions to pixel coordinates in dst, where pixel x, y covers x to
+// x+1 and y to y+1.  samples selects the multisampling pattern used for
+// triangle coverage, and is rounded up to 1, 4 or 8.
+//
+// Each triangle's texture coordinates are interpolated and shaded once per
+// pixel, at the pixel center, with screen-space derivatives taken
+// analytically; the alpha is then blended in to each covered sample and the
+// samples averaged, as with multisampled rendering on a GPU.
+func Rasterize(dst *image.Alpha, m *GlyphMesh, transform mgl32.Mat3, samples int) {
+	pattern := samplePattern8
+	if samples <= 1 {
+		pattern = samplePattern1
+	} else if samples <= 4 {
+		pattern = samplePattern4
+	}
+	ns := len(pattern)
+	bounds := dst.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// per-sample coverage, initialized from what's already in dst:
+	coverage := make([]float32, width*height*ns)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := float32(dst.Pix[y*dst.Stride+x]) / 255
+			for s := 0; s < ns; s++ {
+				coverage[(y*width+x)*ns+s] = a
+			}
+		}
+	}
+
+	for i := 0; i+2 < len(m.indices); i += 3 {
+		var ps [3]mgl32.Vec2
+		var tcs [3][3]float32
+		for j := 0; j < 3; j++ {
+			idx := m.indices[i+j]
+			p := transform.Mul3x1(mgl32.Vec3{
+				m.positions[2*idx], m.positions[2*idx+1], 1})
+			ps[j] = mgl32.Vec2{p[0], p[1]}
+			tcs[j] = uvTexCoords[m.uvs[idx]&7]
+		}
+		area := edgeFunction(ps[0], ps[1], ps[2])
+		if area == 0 {
+			continue
+		}
+		if area < 0 {
+			ps[1], ps[2] = ps[2], ps[1]
+			tcs[1], tcs[2] = tcs[2], tcs[1]
+			area = -area
+		}
+		// the texture coordinates are affine over the triangle, so their
+		// derivatives are constant:
+		e1 := ps[1].Sub(ps[0])
+		e2 := ps[2].Sub(ps[0])
+		gradient := func(c int) (dx, dy float32) {
+			d1 := tcs[1][c] - tcs[0][c]
+			d2 := tcs[2][c] - tcs[0][c]
+			return (d1*e2[1] - d2*e1[1]) / area, (d2*e1[0] - d1*e2[0]) / area
+		}
+		udx, udy := gradient(0)
+		vdx, vdy := gradient(1)
+		zdx, zdy := gradient(2)
+
+		xMin := int(math.Floor(float64(min(ps[0][0], ps[1][0], ps[2][0]))))
+		xMax := int(math.Ceil(float64(max(ps[0][0], ps[1][0], ps[2][0]))))
+		yMin := int(math.Floor(float64(min(ps[0][1], ps[1][1], ps[2][1]))))
+		yMax := int(math.Ceil(float64(max(ps[0][1], ps[1][1], ps[2][1]))))
+		xMin, yMin = max(xMin, 0), max(yMin, 0)
+		xMax, yMax = min(xMax, width-1), min(yMax, height-1)
+		for y := yMin; y <= yMax; y++ {
+			for x := xMin; x <= xMax; x++ {
+				center := mgl32.Vec2{float32(x) + 0.5, float32(y) + 0.5}
+				alpha := float32(-1)
+				for s, offset := range pattern {
+					p := mgl32.Vec2{center[0] + offset[0]/16, center[1] + offset[1]/16}
+					if !triangleCovers(ps, p) {
+						continue
+					}
+					if alpha < 0 {
+						d := center.Sub(ps[0])
+						u := tcs[0][0] + udx*d[0] + udy*d[1]
+						v := tcs[0][1] + vdx*d[0] + vdy*d[1]
+						z := tcs[0][2] + zdx*d[0] + zdy*d[1]
+						alpha = shadeFragment(u, v, z, udx, udy, vdx, vdy)
+					}
+					c := &coverage[(y*width+x)*ns+s]
+					*c = alpha + *c*(1-alpha)
+				}
+			}
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := float32(0)
+			for s := 0; s < ns; s++ {
+				sum += coverage[(y*width+x)*ns+s]
+			}
+			dst.Pix[y*dst.Stride+x] = uint8(sum/float32(ns)*255 + 0.5)
+		}
+	}
+}
+
+// shadeFragment returns the alpha computed by the demo's fragShader for the
+// texture coordinate u, v, z with the given screen-space derivatives.
+func shadeFragment(u, v, z, udx, udy, vdx, vdy float32) float32 {
+	fx := (2*u)*udx - vdx
+	fy := (2*u)*udy - vdy
+	sd := (u*u - v) / max(float32(math.Sqrt(float64(fx*fx+fy*fy))), 1e-7)
+	return mgl32.Clamp(0.5-(2*z-1)*sd, 0, 1)
+}
+
+// edgeFunction returns twice the signed area of the triangle abc.  It is
+// positive when c is to the right of ab with y pointing down.
+func edgeFunction(a, b, c mgl32.Vec2) float32 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// triangleCovers reports whether p is covered by the positively wound triangle
+// ps, using the top-left rule for points exactly on an edge so that triangles
+// sharing an edge never both cover a sample.
+func triangleCovers(ps [3]mgl32.Vec2, p mgl32.Vec2) bool {
+	for j := 0; j < 3; j++ {
+		a, b := ps[j], ps[(j+1)%3]
+		w := edgeFunction(a, b, p)
+		if w < 0 {
+			return false
+		}
+		if w == 0 {
+			dx, dy := b[0]-a[0], b[1]-a[1]
+			topLeft := (dy == 0 && dx > 0) || dy < 0
+			if !topLeft {
+				return false
+			}
+		}
+	}
+	return true
+}
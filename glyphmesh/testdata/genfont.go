@@ -0,0 +1,272 @@
+//go:build ignore
+
+// Genfont writes testfont.ttf, the font used by the tests.  It copies the
+// outlines of a few Latin letters, symbols and the digits out of Go-Regular,
+// and adds a simplified drawing of the Hangul syllable 께 made of lines and
+// quadratic curves, since the Go fonts have no Hangul.
+//
+// Usage:
+//
+//	go run genfont.go path/to/Go-Regular.ttf
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// runes copied from the source font; see also testRunes in glyphmesh_test.go.
+const latinRunes = "&@0123456789AQRSWacghimorsy"
+
+type point struct {
+	x, y    int16
+	onCurve bool
+}
+
+type glyph struct {
+	r        rune
+	advance  uint16
+	contours [][]point
+}
+
+func on(x, y int16) point  { return point{x, y, true} }
+func off(x, y int16) point { return point{x, y, false} }
+
+// hangulGlyph is ㄲ beside ㅔ, drawn for a 2048 unit em with clockwise outer
+// contours.
+func hangulGlyph() glyph {
+	giyeok := func(dx int16) []point {
+		return []point{
+			on(dx+120, 1350), on(dx+480, 1350), on(dx+480, 950),
+			off(dx+480, 640), on(dx+240, 520), on(dx+210, 590),
+			off(dx+390, 690), on(dx+390, 950), on(dx+390, 1270),
+			on(dx+120, 1270),
+		}
+	}
+	return glyph{
+		r:       '께',
+		advance: 2048,
+		contours: [][]point{
+			giyeok(0),
+			giyeok(440),
+			{
+				on(1300, 1500), on(1390, 1500), on(1390, -150), on(1300, -150),
+				on(1300, 700), on(1000, 700), on(1000, 790), on(1300, 790),
+			},
+			{
+				on(1650, 1450), off(1650, 1560), on(1695, 1560), off(1740, 1560),
+				on(1740, 1450), on(1740, -200), on(1650, -200),
+			},
+		},
+	}
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: go run genfont.go path/to/Go-Regular.ttf")
+		os.Exit(2)
+	}
+	buf, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := truetype.Parse(buf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if src.FUnitsPerEm() != 2048 {
+		log.Fatalf("%s: expected 2048 units per em", os.Args[1])
+	}
+
+	glyphs := []glyph{{advance: 1024}} // .notdef
+	gb := truetype.NewGlyphBuf()
+	for _, r := range latinRunes {
+		idx := src.Index(r)
+		if idx == 0 {
+			log.Fatalf("%s has no glyph for %q", os.Args[1], r)
+		}
+		// loading at a scale of one unit per unit gives the outline unscaled:
+		if err := gb.Load(src, 2048, idx, truetype.NoHinting); err != nil {
+			log.Fatal(err)
+		}
+		g := glyph{r: r, advance: uint16(src.HMetric(2048, idx).AdvanceWidth)}
+		start := 0
+		for _, end := range gb.End {
+			var contour []point
+			for _, p := range gb.Point[start:end] {
+				contour = append(contour, point{int16(p.X), int16(p.Y), p.Flags&1 != 0})
+			}
+			g.contours = append(g.contours, contour)
+			start = end
+		}
+		glyphs = append(glyphs, g)
+	}
+	glyphs = append(glyphs, hangulGlyph())
+	sort.Slice(glyphs[1:], func(i, j int) bool { return glyphs[1+i].r < glyphs[1+j].r })
+
+	if err := ioutil.WriteFile("testfont.ttf", encodeFont(glyphs), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// encodeFont returns a TrueType font holding glyphs, with just the tables
+// needed to parse and load glyphs unhinted.
+func encodeFont(glyphs []glyph) []byte {
+	be := binary.BigEndian
+	var glyf, loca, hmtx bytes.Buffer
+	put := func(b *bytes.Buffer, vs ...interface{}) {
+		for _, v := range vs {
+			binary.Write(b, be, v)
+		}
+	}
+
+	xMin, yMin, xMax, yMax := int16(0x7fff), int16(0x7fff), int16(-0x8000), int16(-0x8000)
+	maxPoints, maxContours := 0, 0
+	advanceMax := uint16(0)
+	for _, g := range glyphs {
+		put(&loca, uint32(glyf.Len()))
+		gxMin, gyMin, gxMax, gyMax := int16(0x7fff), int16(0x7fff), int16(-0x8000), int16(-0x8000)
+		numPoints := 0
+		for _, c := range g.contours {
+			for _, p := range c {
+				gxMin, gyMin = min(gxMin, p.x), min(gyMin, p.y)
+				gxMax, gyMax = max(gxMax, p.x), max(gyMax, p.y)
+			}
+			numPoints += len(c)
+		}
+		if len(g.contours) == 0 {
+			gxMin, gyMin, gxMax, gyMax = 0, 0, 0, 0
+		} else {
+			xMin, yMin = min(xMin, gxMin), min(yMin, gyMin)
+			xMax, yMax = max(xMax, gxMax), max(yMax, gyMax)
+			maxPoints, maxContours = max(maxPoints, numPoints), max(maxContours, len(g.contours))
+
+			put(&glyf, int16(len(g.contours)), gxMin, gyMin, gxMax, gyMax)
+			end := 0
+			for _, c := range g.contours {
+				end += len(c)
+				put(&glyf, uint16(end-1))
+			}
+			put(&glyf, uint16(0)) // no instructions
+			// every coordinate is written as a 16-bit delta, so the only
+			// flag needed is on-curve:
+			for _, c := range g.contours {
+				for _, p := range c {
+					flag := uint8(0)
+					if p.onCurve {
+						flag = 1
+					}
+					put(&glyf, flag)
+				}
+			}
+			var x, y int16
+			for _, c := range g.contours {
+				for _, p := range c {
+					put(&glyf, p.x-x)
+					x = p.x
+				}
+			}
+			for _, c := range g.contours {
+				for _, p := range c {
+					put(&glyf, p.y-y)
+					y = p.y
+				}
+			}
+			for glyf.Len()%4 != 0 {
+				glyf.WriteByte(0)
+			}
+		}
+		put(&hmtx, g.advance, gxMin)
+		advanceMax = max(advanceMax, g.advance)
+	}
+	put(&loca, uint32(glyf.Len()))
+
+	var head bytes.Buffer
+	put(&head, uint32(0x00010000), uint32(0x00010000), uint32(0), uint32(0x5f0f3cf5),
+		uint16(0x000b), uint16(2048), uint64(0), uint64(0),
+		xMin, yMin, xMax, yMax,
+		uint16(0), uint16(8), int16(2), int16(1), int16(0))
+
+	var hhea bytes.Buffer
+	put(&hhea, uint32(0x00010000), int16(1900), int16(-500), int16(0),
+		advanceMax, int16(0), int16(0), xMax,
+		int16(1), int16(0), int16(0), [4]int16{}, int16(0), uint16(len(glyphs)))
+
+	var maxp bytes.Buffer
+	put(&maxp, uint32(0x00010000), uint16(len(glyphs)),
+		uint16(maxPoints), uint16(maxContours), uint16(0), uint16(0),
+		uint16(2), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0),
+		uint16(0), uint16(0), uint16(0))
+
+	// cmap: a format 4 subtable with a segment per glyph.
+	var cmap bytes.Buffer
+	segCount := len(glyphs) // the glyphs after .notdef, and the final segment
+	searchRange := 2
+	entrySelector := 0
+	for searchRange*2 <= segCount*2 {
+		searchRange *= 2
+		entrySelector++
+	}
+	put(&cmap, uint16(0), uint16(1), uint16(3), uint16(1), uint32(12))
+	put(&cmap, uint16(4), uint16(16+8*segCount), uint16(0),
+		uint16(2*segCount), uint16(searchRange), uint16(entrySelector),
+		uint16(2*segCount-searchRange))
+	for _, g := range glyphs[1:] {
+		put(&cmap, uint16(g.r))
+	}
+	put(&cmap, uint16(0xffff), uint16(0))
+	for _, g := range glyphs[1:] {
+		put(&cmap, uint16(g.r))
+	}
+	put(&cmap, uint16(0xffff))
+	for i, g := range glyphs[1:] {
+		put(&cmap, uint16(i+1)-uint16(g.r))
+	}
+	put(&cmap, uint16(1))
+	for range glyphs {
+		put(&cmap, uint16(0))
+	}
+
+	tables := []struct {
+		tag  string
+		data []byte
+	}{
+		{"cmap", cmap.Bytes()},
+		{"glyf", glyf.Bytes()},
+		{"head", head.Bytes()},
+		{"hhea", hhea.Bytes()},
+		{"hmtx", hmtx.Bytes()},
+		{"loca", loca.Bytes()},
+		{"maxp", maxp.Bytes()},
+	}
+	var font bytes.Buffer
+	put(&font, uint32(0x00010000), uint16(len(tables)), uint16(64), uint16(2), uint16(16*len(tables)-64))
+	offset := 12 + 16*len(tables)
+	for _, t := range tables {
+		padded := append([]byte(nil), t.data...)
+		for len(padded)%4 != 0 {
+			padded = append(padded, 0)
+		}
+		sum := uint32(0)
+		for i := 0; i < len(padded); i += 4 {
+			sum += be.Uint32(padded[i:])
+		}
+		font.WriteString(t.tag)
+		put(&font, sum, uint32(offset), uint32(len(t.data)))
+		offset += len(padded)
+	}
+	for _, t := range tables {
+		font.Write(t.data)
+		for font.Len()%4 != 0 {
+			font.WriteByte(0)
+		}
+	}
+	return font.Bytes()
+}
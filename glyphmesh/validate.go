@@ -0,0 +1,128 @@
+package glyphmesh
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// validateSpacing is the largest distance between the points sampled
+	// within each triangle by ValidateMesh, in ems.
+	validateSpacing = 1.0 / 128
+	// validateTolerance is how close to the outline a sample may be and still
+	// disagree with it, in ems, since the mesh is only accurate to float32.
+	validateTolerance = 1.0 / 4096
+)
+
+// A MeshError reports the triangles of a GlyphMesh that fill a different
+// region than the outline it was built from.
+type MeshError struct {
+	Triangles []TriangleMismatch
+}
+
+// A TriangleMismatch is a triangle in a GlyphMesh whose coverage disagrees
+// with the outline.
+type TriangleMismatch struct {
+	// Triangle is the index of the triangle, whose vertices are at
+	// Indices()[3*Triangle:3*Triangle+3].
+	Triangle int
+	Vertices [3]mgl32.Vec2
+	UVs      [3]int8
+	// Point is one of the points sampled where the mesh and the outline
+	// disagree; Inside reports whether it is inside the outline.
+	Point  mgl32.Vec2
+	Inside bool
+	// Mismatches is the number of points sampled that disagreed, out of
+	// Samples.
+	Mismatches, Samples int
+}
+
+func (e *MeshError) Error() string {
+	t := e.Triangles[0]
+	s := fmt.Sprintf("glyphmesh: %d triangles disagree with the outline; "+
+		"triangle %d (%v, %v, %v) with uvs %v", len(e.Triangles),
+		t.Triangle, t.Vertices[0], t.Vertices[1], t.Vertices[2], t.UVs)
+	if t.Inside {
+		return s + fmt.Sprintf(" leaves %v unfilled", t.Point)
+	}
+	return s + fmt.Sprintf(" fills %v", t.Point)
+}
+
+// ValidateMesh checks that mesh fills the same region as outline.  Points are
+// sampled densely within each triangle of the mesh, and whether the mesh fills
+// each point, as the demo's shaders would, is compared with whether the point
+// is inside the outline by the nonzero winding rule.  Points very close to
+// the outline are ignored.  If any triangles disagree, the error returned is a
+// *MeshError describing them.
+//
+// Only the triangles of the mesh are checked, so parts of the outline that no
+// triangle covers at all aren't reported.
+func ValidateMesh(outline *Outline, mesh *GlyphMesh) error {
+	var e MeshError
+	for i := 0; i+2 < len(mesh.indices); i += 3 {
+		var ps [3]mgl32.Vec2
+		var tcs [3][3]float32
+		var uvs [3]int8
+		for j := 0; j < 3; j++ {
+			idx := mesh.indices[i+j]
+			ps[j] = mgl32.Vec2{mesh.positions[2*idx], mesh.positions[2*idx+1]}
+			uvs[j] = mesh.uvs[idx]
+			tcs[j] = uvTexCoords[uvs[j]&7]
+		}
+		longest := max(ps[1].Sub(ps[0]).Len(), ps[2].Sub(ps[1]).Len(), ps[0].Sub(ps[2]).Len())
+		n := max(1, int(math.Ceil(float64(longest/validateSpacing))))
+
+		mismatch := TriangleMismatch{Triangle: i / 3, Vertices: ps, UVs: uvs}
+		// sample the centroids of the n^2 triangles that the triangle divides
+		// in to when each edge is split in n:
+		for a := 0; a < n; a++ {
+			for b := 0; a+b < n; b++ {
+				for _, w := range [][2]float32{{1.0 / 3, 1.0 / 3}, {2.0 / 3, 2.0 / 3}} {
+					if a+b == n-1 && w[0] > 0.5 {
+						continue // no upside-down triangle in the last row
+					}
+					wa := (float32(a) + w[0]) / float32(n)
+					wb := (float32(b) + w[1]) / float32(n)
+					wc := 1 - wa - wb
+					p := ps[0].Mul(wc).Add(ps[1].Mul(wa)).Add(ps[2].Mul(wb))
+					var tc [3]float32
+					for k := range tc {
+						tc[k] = tcs[0][k]*wc + tcs[1][k]*wa + tcs[2][k]*wb
+					}
+					filled := (2*tc[2]-1)*(tc[0]*tc[0]-tc[1]) < 0
+					inside := outline.Winding(p) != 0
+					mismatch.Samples++
+					if filled == inside || outline.near(p, validateTolerance) {
+						continue
+					}
+					if mismatch.Mismatches == 0 {
+						mismatch.Point = p
+						mismatch.Inside = inside
+					}
+					mismatch.Mismatches++
+				}
+			}
+		}
+		if mismatch.Mismatches > 0 {
+			e.Triangles = append(e.Triangles, mismatch)
+		}
+	}
+	if len(e.Triangles) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// near reports whether p is within d of the outline.
+func (o *Outline) near(p mgl32.Vec2, d float32) bool {
+	for _, c := range o.Contours {
+		for _, s := range c {
+			if s.distance(p) < d {
+				return true
+			}
+		}
+	}
+	return false
+}
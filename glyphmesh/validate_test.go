@@ -0,0 +1,54 @@
+package glyphmesh
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateMesh(t *testing.T) {
+	mesher := NewMesher(loadTestFont(t))
+	for _, r := range testRunes {
+		m, err := mesher.Mesh(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := mesher.Outline(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateMesh(o, m); err != nil {
+			t.Errorf("%q: %v", r, err)
+		}
+
+		// a mesh with an interior triangle turned exterior must be caught:
+		bad := *m
+		bad.uvs = append([]int8(nil), m.uvs...)
+		tri := -1
+		for i := 0; i < len(bad.indices); i += 3 {
+			if bad.uvs[bad.indices[i]] == UVInterior {
+				tri = i / 3
+				break
+			}
+		}
+		if tri < 0 {
+			t.Fatalf("%q: no interior triangles", r)
+		}
+		for _, idx := range bad.indices[3*tri : 3*tri+3] {
+			bad.uvs[idx] = UVExterior
+		}
+		var e *MeshError
+		if err := ValidateMesh(o, &bad); !errors.As(err, &e) {
+			t.Errorf("%q: got %v for a mesh with an exterior triangle %d", r, err, tri)
+			continue
+		}
+		found := false
+		for _, mismatch := range e.Triangles {
+			if mismatch.Triangle == tri {
+				found = mismatch.Inside
+			}
+		}
+		if !found {
+			t.Errorf("%q: exterior triangle %d wasn't reported in %v", r, tri, e.Triangles)
+		}
+	}
+}
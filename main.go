@@ -3,13 +3,15 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
 	"os"
 	"runtime"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/davecheney/profile"
 	"github.com/go-gl/gl/v4.1-core/gl"
@@ -18,7 +20,7 @@ import (
 
 	"code.google.com/p/freetype-go/freetype/truetype"
 
-	"github.com/Mischanix/loopblinn/cdt"
+	"github.com/Mischanix/loopblinn/glyphmesh"
 )
 
 func init() {
@@ -64,459 +66,59 @@ func endFrame() {
 }
 
 var font *truetype.Font
-var glyph *truetype.GlyphBuf
+var mesher *glyphmesh.Mesher
+var meshCache = glyphmesh.NewCache(16 << 20)
+var glyphMesh *glyphmesh.GlyphMesh
 
-type GlyphMesh struct {
-	// x, y; u, v; ib
-	positions []float32
-	uvs       []int8
-	indices   []int16
-}
-
-var glyphMesh GlyphMesh
-
-func loadFont(path string) {
+func loadFont(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 
 	buf, err := ioutil.ReadAll(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	font, err = truetype.Parse(buf)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	glyph = truetype.NewGlyphBuf()
+	mesher = glyphmesh.NewMesher(font)
+	mesher.Cache = meshCache
+	return nil
 }
 
-const (
-	uvBeginConvex = iota
-	uvMidConvex
-	uvEndConvex
-	uvBeginConcave
-	uvMidConcave
-	uvEndConcave
-	uvExterior
-	uvInterior
-)
-
-func loadGlyph(r rune) {
-	err := glyph.Load(font, 65536, font.Index(r), truetype.NoHinting)
+func loadGlyph(r rune) error {
+	mesh, err := mesher.Mesh(r)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	glyphMesh = mesh
+	return nil
+}
 
-	// preprocessing
-	type point struct {
-		x, y float32
-		on   bool
-	}
-	type glyphInfo struct {
-		loops [][]point
-	}
-	g := glyphInfo{}
-	i := 0
-	for _, end := range glyph.End {
-		loop := []point{}
-		loopI := 0
-		loopStartI := 0
-		foundStartPoint := false
-		for i < end {
-			p := glyph.Point[i]
-			// (0, 65536) => (0.0, 1.0)
-			x := float32(p.X) / 65536
-			y := float32(p.Y) / 65536
-			on := 0 != (p.Flags & 1)
-			if on && !foundStartPoint {
-				foundStartPoint = true
-				loopStartI = loopI
-			}
-			loop = append(loop, point{x, y, on})
-			loopI++
-			i++
-		}
-		loop = append(loop[loopStartI:], loop[:loopStartI]...)
-		if len(loop) > 1 {
-			g.loops = append(g.loops, loop)
-		}
-	}
+// the line of text drawn by render; keys pressed are appended to it
+var text = "께chgrRo34"
 
-	// Triangulation!
-	i = 0
-	xMin := float32(glyph.B.XMin) / 65536
-	xMax := float32(glyph.B.XMax) / 65536
-	yMin := float32(glyph.B.YMin) / 65536
-	yMax := float32(glyph.B.YMax) / 65536
-	width := xMax - xMin
-	height := yMax - yMin
-	// 10% expansion:
-	xMin -= width * 0.05
-	xMax += width * 0.05
-	yMin -= height * 0.05
-	yMax += height * 0.05
-	// define points and bezier triangles:
-	glyphMesh = GlyphMesh{}
-	positions := make([]float32, 0)
-	uvs := make([]int8, 0)
-	indices := make([]int16, 0)
-	lines := []int16{}
-	addVert := func(x, y float32, uv int8) {
-		positions = append(positions, x, y)
-		uvs = append(uvs, uv)
-	}
-	n := int16(0)
-	addIndex := func(idx int16) {
-		indices = append(indices, idx)
-		n++
-	}
-	addLine := func(a, b int16) {
-		lines = append(lines, a, b)
-	}
-	for _, loop := range g.loops {
-		first := true
-		firstI := int16(-1)
-		firstX := float32(0)
-		firstY := float32(0)
-		prevX := float32(0)
-		prevY := float32(0)
-		prevOn := true
-		var x, y float32
-		for _, pt := range loop {
-			x = pt.x
-			y = pt.y
-			on := pt.on
-			if on {
-				// on => 0,0 / 1,1 uv
-				if !first {
-					if !prevOn {
-						// close last bezier:
-						addVert(x, y, uvEndConvex)
-						addIndex(n)
-					} else {
-						n++
-						addLine(n-1, n)
-					}
-				}
-				// gen 0,0 uv
-				if firstI < 0 {
-					firstI = n
-				}
-				addVert(x, y, uvBeginConvex)
-			} else {
-				if !prevOn {
-					// gen midpoint
-					midX := (x + prevX) / 2
-					midY := (y + prevY) / 2
-					// close last:
-					addVert(midX, midY, uvEndConvex)
-					addIndex(n)
-					// open next:
-					addVert(midX, midY, uvBeginConvex)
-					addIndex(n)
-				} else {
-					// open current:
-					addIndex(n)
-				}
-				addVert(x, y, uvMidConvex)
-				addIndex(n)
-			}
-			if first {
-				firstX = x
-				firstY = y
-				first = false
-			}
-			prevX = x
-			prevY = y
-			prevOn = on
-		}
-		if !prevOn {
-			// close loop by finalizing the last bezier:
-			addVert(firstX, firstY, uvEndConvex)
-			addIndex(n)
-		} else {
-			// close loop with a line, if necessary:
-			if x != firstX || y != firstY {
-				addLine(n, firstI)
-			}
-			n++
-		}
-	}
+const textSize = 0.25
 
-	// tessellate the glyph with CDT:
-	edges := []int32{}
-	for i := 0; i < len(indices); i += 3 {
-		edges = append(edges,
-			int32(indices[i+0]), int32(indices[i+1]),
-			int32(indices[i+1]), int32(indices[i+2]),
-			int32(indices[i+2]), int32(indices[i+0]))
-	}
-	for i := 0; i < len(lines); i += 2 {
-		edges = append(edges, int32(lines[i]), int32(lines[i+1]))
-	}
-	tVerts, srcToDtIs, tTris := cdt.Triangulate(xMin, xMax, yMin, yMax, positions, edges)
-
-	// determine whether a given point is in or outside the glyph shape
-	pointInGlyph := func(q mgl32.Vec2) bool {
-		xs := []float32{}
-		mpxs := []float32{} // used as a tiebreaker
-		interiors := []bool{}
-		intersectQuad := func(p0, p1, p2 mgl32.Vec2) {
-			a := p0[1]
-			b := p1[1]
-			c := p2[1]
-			y := q[1]
-			ts := [2]float32{-1, -1}
-			if a == c && b == y {
-				// undefined
-				return
-			} else if a == b && c == y {
-				ts[0] = 1
-				ts[1] = -1
-			} else if a == y && b == c {
-				ts[0] = 2
-				ts[1] = 0
-			} else if denom := (a - b) + (c - b); !mgl32.FloatEqual(denom, 0) {
-				det := (b-y)*(b-y) + y*(c+a-y) - a*c
-				if det < 0 {
-					// paraboloid never intersects:
-					return
-				}
-				root := float32(math.Sqrt(float64(det)))
-				ts[0] = (root + a - b) / denom
-				ts[1] = (-root + a - b) / denom
-			} else if !mgl32.FloatEqual(b-c, 0) {
-				// quadratic has only one intersection with x = k:
-				ts[0] = (2*b - c - y) / (2 * (b - c))
-			} else {
-				// shouldn't reach here
-				return
-			}
-			for _, t := range ts {
-				if t < 0 || t > 1 {
-					continue
-				}
-				// get x for t:
-				x := (1-t)*((1-t)*p0[0]+t*p1[0]) + t*((1-t)*p1[0]+t*p2[0])
-				mpx := 0.25*p0[0] + 0.5*p1[0] + 0.25*p2[0]
-				if x < q[0] {
-					continue
-				}
-				// to determine interiority, we need the vector derivative of
-				// the bezier at t:
-				dB := p1.Sub(p0).Mul(2 * (1 - t)).Add(p2.Sub(p1).Mul(2 * t))
-				if dB[1] > 0 {
-					// q is exterior
-					xs = append(xs, x)
-					mpxs = append(mpxs, mpx)
-					interiors = append(interiors, false)
-				} else if dB[1] < 0 {
-					// q is interior
-					xs = append(xs, x)
-					mpxs = append(mpxs, mpx)
-					interiors = append(interiors, true)
-				} // otherwise, y = 0 => doesn't matter
-			}
-		}
-		intersectLinear := func(p0, p1 mgl32.Vec2) {
-			if p0[1] == p1[1] {
-				// another segment will determine this
-				return
-			}
-			t := (p0[1] - q[1]) / (p0[1] - p1[1])
-			if t >= 0 && t <= 1 {
-				x := (1-t)*p0[0] + t*p1[0]
-				if x < q[0] {
-					return
-				}
-				mpx := 0.5*p0[0] + 0.5*p1[0]
-				xs = append(xs, x)
-				mpxs = append(mpxs, mpx)
-				if p0[1] < p1[1] {
-					// q is exterior
-					interiors = append(interiors, false)
-				} else {
-					// q is interior
-					interiors = append(interiors, true)
-				}
-			}
-		}
-		// can totally make this better with spatial sorting but that requires
-		// writing code
-		for _, loop := range g.loops {
-			first := true
-			firstX := float32(0)
-			firstY := float32(0)
-			prevX := float32(0)
-			prevY := float32(0)
-			prevOn := true
-			curPts := []mgl32.Vec2{}
-			for _, pt := range loop {
-				x := pt.x
-				y := pt.y
-				on := pt.on
-				if on {
-					if !first {
-						if !prevOn {
-							// close last bezier:
-							intersectQuad(curPts[0], curPts[1], mgl32.Vec2{x, y})
-							curPts = []mgl32.Vec2{}
-						} else {
-							intersectLinear(curPts[0], mgl32.Vec2{x, y})
-							curPts = []mgl32.Vec2{}
-						}
-					}
-					curPts = append(curPts, mgl32.Vec2{x, y})
-				} else {
-					if !prevOn {
-						// gen midpoint
-						midX := (x + prevX) / 2
-						midY := (y + prevY) / 2
-						// close last:
-						intersectQuad(curPts[0], curPts[1], mgl32.Vec2{midX, midY})
-						// open next:
-						curPts = []mgl32.Vec2{mgl32.Vec2{midX, midY}}
-					} // else, we're beginning a new bspline..
-					curPts = append(curPts, mgl32.Vec2{x, y})
-				}
-				if first {
-					firstX = x
-					firstY = y
-					first = false
-				}
-				prevX = x
-				prevY = y
-				prevOn = on
-			}
-			if !prevOn {
-				intersectQuad(curPts[0], curPts[1], mgl32.Vec2{firstX, firstY})
-				curPts = []mgl32.Vec2{}
-			} else {
-				intersectLinear(curPts[0], mgl32.Vec2{firstX, firstY})
-			}
-		}
-		xMin := float32(math.MaxFloat32)
-		mpxMin := float32(math.MaxFloat32)
-		result := false
-		for i := 0; i < len(xs); i++ {
-			if xs[i] < xMin || (xs[i] == xMin && mpxs[i] < mpxMin) {
-				xMin = xs[i]
-				mpxMin = mpxs[i]
-				result = interiors[i]
-			}
-		}
-		return result
-	}
-	// to build final mesh:
-	// iterate over indices, finding the corresponding triangles in tTris
-	// insert those triangles with the appropriate uvs as given by uvs, and mark
-	// them as inserted against tTris
-	// then, iterate over tTris, for all not-yet-inserted triangles: test
-	// whether triangle center is in the glyph; if so, the triangle uvs should
-	// be [0 1], otherwise the triangle uvs should be [1 0] to compress, scan
-	// glyphMesh for a matching vertex before insertion of a new vertex.
-	splineTriangleIs := []int{}
-	for i := 0; i < len(indices); i += 3 {
-		dtVI0 := srcToDtIs[int(indices[i])]
-		dtVI1 := srcToDtIs[int(indices[i+1])]
-		dtVI2 := srcToDtIs[int(indices[i+2])]
-		triI := -1
-		srcIs := []int{}
-		concave := false
-		for j := 0; j < len(tTris); j += 3 {
-			triI = j
-			if dtVI0 == tTris[j] {
-				if dtVI1 == tTris[j+1] && dtVI2 == tTris[j+2] {
-					srcIs = []int{0, 1, 2}
-					break
-				} else if dtVI1 == tTris[j+2] && dtVI2 == tTris[j+1] {
-					srcIs = []int{0, 2, 1}
-					concave = true
-					break
-				}
-			} else if dtVI0 == tTris[j+1] {
-				if dtVI1 == tTris[j+2] && dtVI2 == tTris[j] {
-					srcIs = []int{1, 2, 0}
-					break
-				} else if dtVI1 == tTris[j] && dtVI2 == tTris[j+2] {
-					srcIs = []int{1, 0, 2}
-					concave = true
-					break
-				}
-			} else if dtVI0 == tTris[j+2] {
-				if dtVI1 == tTris[j] && dtVI2 == tTris[j+1] {
-					srcIs = []int{2, 0, 1}
-					break
-				} else if dtVI1 == tTris[j+1] && dtVI2 == tTris[j] {
-					srcIs = []int{2, 1, 0}
-					concave = true
-					break
-				}
-			}
-		}
-		splineTriangleIs = append(splineTriangleIs, triI)
-		// ...
-		for _, n := range srcIs {
-			idx := int(indices[i+n])
-			dtVIn := srcToDtIs[idx]
-			uv := uvs[idx]
-			if concave {
-				uv += 3
-			}
-			pos := mgl32.Vec2{tVerts[dtVIn], tVerts[dtVIn+1]}
-			dstVertI := len(glyphMesh.positions) / 2
-			glyphMesh.positions = append(glyphMesh.positions, pos[0], pos[1])
-			glyphMesh.uvs = append(glyphMesh.uvs, uv)
-			glyphMesh.indices = append(glyphMesh.indices, int16(dstVertI))
-		}
-	}
-	for i := 0; i < len(tTris); i += 3 {
-		isSpline := false
-		for _, j := range splineTriangleIs {
-			if j == i {
-				isSpline = true
-				break
-			}
-		}
-		if isSpline {
-			continue
-		}
-		p0 := mgl32.Vec2{tVerts[tTris[i]], tVerts[tTris[i]+1]}
-		p1 := mgl32.Vec2{tVerts[tTris[i+1]], tVerts[tTris[i+1]+1]}
-		p2 := mgl32.Vec2{tVerts[tTris[i+2]], tVerts[tTris[i+2]+1]}
-		mp := p0.Add(p1).Add(p2).Mul(float32(1) / float32(3))
-		uv := int8(uvExterior)
-		if pointInGlyph(mp) {
-			uv = uvInterior
-		}
-		ps := []mgl32.Vec2{p0, p1, p2}
-		for _, p := range ps {
-			dstVertI := -1
-			for j := 0; j < len(glyphMesh.positions); j += 2 {
-				if glyphMesh.positions[j] == p[0] &&
-					glyphMesh.positions[j+1] == p[1] &&
-					glyphMesh.uvs[j/2] == uv {
-					dstVertI = j / 2
-					break
-				}
-			}
-			if dstVertI < 0 {
-				dstVertI = len(glyphMesh.positions) / 2
-				glyphMesh.positions = append(glyphMesh.positions, p[0], p[1])
-				glyphMesh.uvs = append(glyphMesh.uvs, uv)
-			}
-			glyphMesh.indices = append(glyphMesh.indices, int16(dstVertI))
-		}
+func layoutText() error {
+	mesh, err := mesher.Layout(text, textSize)
+	if err != nil {
+		return err
 	}
+	glyphMesh = mesh
+	return nil
 }
 
 var prog uint32
 var vao uint32
 var vbos [3]uint32
+var indexType uint32
 
 var transform mgl32.Mat4
 var invTransform mgl32.Mat4
@@ -551,7 +153,7 @@ func renderInit() {
 func bindBuffers() {
 	gl.BindBuffer(gl.ARRAY_BUFFER, vbos[0])
 	gl.BufferData(gl.ARRAY_BUFFER,
-		4*len(glyphMesh.positions), gl.Ptr(glyphMesh.positions),
+		4*len(glyphMesh.Positions()), gl.Ptr(glyphMesh.Positions()),
 		gl.STATIC_DRAW)
 	posAttrib := uint32(gl.GetAttribLocation(prog, gl.Str("pos\x00")))
 	gl.EnableVertexAttribArray(posAttrib)
@@ -559,14 +161,23 @@ func bindBuffers() {
 
 	gl.BindBuffer(gl.ARRAY_BUFFER, vbos[1])
 	gl.BufferData(gl.ARRAY_BUFFER,
-		len(glyphMesh.uvs), gl.Ptr(glyphMesh.uvs), gl.STATIC_DRAW)
+		len(glyphMesh.UVs()), gl.Ptr(glyphMesh.UVs()), gl.STATIC_DRAW)
 	uvAttrib := uint32(gl.GetAttribLocation(prog, gl.Str("uvI\x00")))
 	gl.EnableVertexAttribArray(uvAttrib)
 	gl.VertexAttribIPointer(uvAttrib, 1, gl.BYTE, 1, gl.PtrOffset(0))
 
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, vbos[2])
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER,
-		2*len(glyphMesh.indices), gl.Ptr(glyphMesh.indices), gl.STATIC_DRAW)
+	if glyphMesh.IndexFormat() == glyphmesh.Index16 {
+		indices := glyphMesh.Indices16()
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER,
+			2*len(indices), gl.Ptr(indices), gl.STATIC_DRAW)
+		indexType = gl.UNSIGNED_SHORT
+	} else {
+		indices := glyphMesh.Indices()
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER,
+			4*len(indices), gl.Ptr(indices), gl.STATIC_DRAW)
+		indexType = gl.UNSIGNED_INT
+	}
 }
 
 func render() {
@@ -574,7 +185,7 @@ func render() {
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
 	gl.DrawElements(gl.TRIANGLES,
-		int32(len(glyphMesh.indices)), gl.UNSIGNED_SHORT, gl.PtrOffset(0))
+		int32(len(glyphMesh.Indices())), indexType, gl.PtrOffset(0))
 }
 
 func onKey(w *glfw.Window, k glfw.Key, scancode int,
@@ -587,9 +198,24 @@ func onKey(w *glfw.Window, k glfw.Key, scancode int,
 		lowercase = 0x20
 	}
 	if action == glfw.Press {
-		r := rune(int(k) | lowercase)
-		loadGlyph(r)
-		fmt.Println("rune is now:", string(r))
+		prevText := text
+		if k == glfw.KeyBackspace {
+			if len(text) > 0 {
+				_, size := utf8.DecodeLastRuneInString(text)
+				text = text[:len(text)-size]
+			}
+		} else if k < 128 {
+			// printable keys map to ascii
+			text += string(rune(int(k) | lowercase))
+		} else {
+			return
+		}
+		if err := layoutText(); err != nil {
+			fmt.Println(err)
+			text = prevText
+			return
+		}
+		fmt.Println("text is now:", text)
 		bindBuffers()
 	}
 }
@@ -604,7 +230,14 @@ func onCursorPos(w *glfw.Window, xpos, ypos float64) {
 	bindBuffers()
 }
 
+var fontPath = flag.String("font", "SeoulNamsan-Light.ttf", "TrueType font to render")
+
 func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		text = strings.Join(flag.Args(), " ")
+	}
+
 	if err := glfw.Init(); err != nil {
 		log.Fatalln("failed to initialize glfw:", err)
 	}
@@ -628,23 +261,27 @@ func main() {
 	window.SetKeyCallback(onKey)
 	window.SetCursorPosCallback(onCursorPos)
 
-	loadFont("SeoulNamsan-Light.ttf")
+	if err := loadFont(*fontPath); err != nil {
+		log.Fatalln("failed to load font:", err)
+	}
 	startTime := glfw.GetTime()
 	profile.CPUProfile.ProfilePath = "."
 	prof := profile.Start(profile.CPUProfile)
 	for i := 0; i < 100; i++ {
-		loadGlyph('께')
-		loadGlyph('c')
-		loadGlyph('h')
-		loadGlyph('g')
-		loadGlyph('r')
-		loadGlyph('R')
-		loadGlyph('o')
-		loadGlyph('3')
-		loadGlyph('4')
+		for _, r := range "께chgrRo34" {
+			if err := loadGlyph(r); err != nil {
+				log.Fatalln(err)
+			}
+		}
 	}
 	prof.Stop()
 	fmt.Printf("loadGlyphs took %fms\n", 1e3*(glfw.GetTime()-startTime))
+	stats := meshCache.Stats()
+	fmt.Printf("mesh cache: %d hits, %d misses, %d meshes in %d bytes\n",
+		stats.Hits, stats.Misses, stats.Meshes, stats.Bytes)
+	if err := layoutText(); err != nil {
+		log.Fatalln(err)
+	}
 
 	renderInit()
 